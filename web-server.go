@@ -1,13 +1,37 @@
 package main
 
 import (
+    "bufio"
+    "bytes"
+    "context"
+    cryptorand "crypto/rand"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
     "encoding/json"
+    "encoding/xml"
+    "errors"
+    "flag"
     "fmt"
+    "io"
     "log"
+    "math"
+    "net"
     "net/http"
+    "net/url"
     "os"
     "os/exec"
+    "os/signal"
+    "path/filepath"
+    "regexp"
+    "slices"
+    "sort"
+    "strconv"
     "strings"
+    "sync"
+    "syscall"
+    "text/tabwriter"
     "time"
     "math/rand"
 )
@@ -16,6 +40,7 @@ import (
 type SystemStatus struct {
     Timestamp       string                 `json:"timestamp"`
     Status          string                 `json:"status"`
+    Connected       bool                   `json:"connected"`
     Agents          int                    `json:"agents"`
     Generation      int                    `json:"generation"`
     FitnessScore    float64                `json:"fitness_score"`
@@ -24,6 +49,31 @@ type SystemStatus struct {
     ActiveWorkflows int                    `json:"active_workflows"`
     MemoryUsageMB   float64                `json:"memory_usage_mb"`
     Components      map[string]Component   `json:"components"`
+    SnapshotAgeMS   int64                  `json:"snapshot_age_ms"`
+    Error           string                 `json:"error,omitempty"`
+    Sources         map[string]string      `json:"sources"`
+}
+
+// Where each SystemStatus field came from. A field whose source is
+// SourceUnknown holds its zero value and must not be displayed as real.
+const (
+    SourceDagger    = "dagger"
+    SourceSimulated = "simulated"
+    SourceUnknown   = "unknown"
+)
+
+// statusFields lists the SystemStatus fields annotated in Sources
+var statusFields = []string{
+    "agents", "generation", "fitness_score", "success_rate", "total_functions",
+    "active_workflows", "memory_usage_mb", "components",
+}
+
+func unknownSources() map[string]string {
+    sources := make(map[string]string, len(statusFields))
+    for _, field := range statusFields {
+        sources[field] = SourceUnknown
+    }
+    return sources
 }
 
 type Component struct {
@@ -39,399 +89,7418 @@ type MetricsData struct {
     MemoryMB    float64 `json:"memory_mb"`
 }
 
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-        
-        if r.Method == "OPTIONS" {
-            w.WriteHeader(http.StatusOK)
-            return
+// DaggerRunner executes Dagger operations on behalf of the HTTP handlers.
+// Handlers never shell out directly so the backend can be swapped, e.g. for
+// a recorded fake on machines without the Dagger CLI.
+// Implementations must stop work and return promptly once ctx is done.
+type DaggerRunner interface {
+    // Functions returns the raw output of `dagger functions`
+    Functions(ctx context.Context) ([]byte, error)
+    // Help returns the raw output of `dagger call <function> --help`
+    Help(ctx context.Context, function string) ([]byte, error)
+    // Call runs `dagger call <function> <args...>` and returns its stdout
+    Call(ctx context.Context, function string, args ...string) ([]byte, error)
+}
+
+// DaggerInvocation records a single call made through a DaggerRunner
+type DaggerInvocation struct {
+    Function  string   `json:"function"`
+    Args      []string `json:"args"`
+    Timestamp string   `json:"timestamp"`
+}
+
+// CLIRunner runs Dagger functions through the dagger CLI
+type CLIRunner struct {
+    Binary string
+}
+
+func NewCLIRunner() *CLIRunner {
+    return &CLIRunner{Binary: "dagger"}
+}
+
+func (c *CLIRunner) Functions(ctx context.Context) ([]byte, error) {
+    return run(ctx, c.command(ctx, "functions"))
+}
+
+func (c *CLIRunner) Help(ctx context.Context, function string) ([]byte, error) {
+    return run(ctx, c.command(ctx, "call", function, "--help"))
+}
+
+func (c *CLIRunner) Call(ctx context.Context, function string, args ...string) ([]byte, error) {
+    cmdArgs := append([]string{"call", function}, args...)
+    return run(ctx, c.command(ctx, cmdArgs...))
+}
+
+// run is cmd.Output() that also streams stdout and stderr line by line to
+// the context's LogSink, and keeps stderr on the *exec.ExitError
+func run(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+    sink := logSinkFromContext(ctx)
+    stdout := &lineWriter{sink: sink, stream: "stdout"}
+    stderr := &lineWriter{sink: sink, stream: "stderr"}
+    cmd.Stdout = stdout
+    cmd.Stderr = stderr
+    
+    err := cmd.Run()
+    stdout.Flush()
+    stderr.Flush()
+    
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        exitErr.Stderr = stderr.buf.Bytes()
+    }
+    return stdout.buf.Bytes(), err
+}
+
+// LogSink receives a runner's output line by line as it is produced
+type LogSink func(stream, line string)
+
+type logSinkContextKey struct{}
+
+// WithLogSink makes runners called with ctx stream their output to sink
+func WithLogSink(ctx context.Context, sink LogSink) context.Context {
+    return context.WithValue(ctx, logSinkContextKey{}, sink)
+}
+
+func logSinkFromContext(ctx context.Context) LogSink {
+    sink, _ := ctx.Value(logSinkContextKey{}).(LogSink)
+    return sink
+}
+
+// emitLines sends already-complete output to the context's LogSink, for
+// runners that do not produce it incrementally
+func emitLines(ctx context.Context, stream, text string) {
+    sink := logSinkFromContext(ctx)
+    if sink == nil || text == "" {
+        return
+    }
+    for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+        sink(stream, line)
+    }
+}
+
+// lineWriter keeps everything written to it and hands each complete line
+// to a LogSink
+type lineWriter struct {
+    sink    LogSink
+    stream  string
+    buf     bytes.Buffer
+    partial []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+    lw.buf.Write(p)
+    if lw.sink == nil {
+        return len(p), nil
+    }
+    lw.partial = append(lw.partial, p...)
+    for {
+        i := bytes.IndexByte(lw.partial, '\n')
+        if i < 0 {
+            break
+        }
+        lw.sink(lw.stream, strings.TrimSuffix(string(lw.partial[:i]), "\r"))
+        lw.partial = lw.partial[i+1:]
+    }
+    return len(p), nil
+}
+
+// Flush emits a final line that had no trailing newline
+func (lw *lineWriter) Flush() {
+    if lw.sink != nil && len(lw.partial) > 0 {
+        lw.sink(lw.stream, string(lw.partial))
+        lw.partial = nil
+    }
+}
+
+// command starts dagger in its own process group so cancelling ctx kills
+// the CLI together with any children it spawned
+func (c *CLIRunner) command(ctx context.Context, args ...string) *exec.Cmd {
+    cmd := exec.CommandContext(ctx, c.Binary, args...)
+    // Dagger reads TRACEPARENT, so engine spans join the caller's trace
+    if span := SpanFromContext(ctx); span != nil {
+        cmd.Env = append(os.Environ(), "TRACEPARENT="+span.Traceparent())
+    }
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+    cmd.Cancel = func() error {
+        return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+    }
+    cmd.WaitDelay = 5 * time.Second
+    return cmd
+}
+
+// FakeResponse is the canned result a FakeRunner returns for a function
+type FakeResponse struct {
+    Output  string `json:"output"`
+    Stderr  string `json:"stderr,omitempty"`
+    Error   string `json:"error,omitempty"`
+    DelayMS int    `json:"delay_ms,omitempty"`
+}
+
+// FakeRunner answers calls from canned responses and records every
+// invocation so callers can assert exactly what was run
+type FakeRunner struct {
+    mu          sync.Mutex
+    responses   map[string]FakeResponse
+    invocations []DaggerInvocation
+}
+
+func NewFakeRunner(responses map[string]FakeResponse) *FakeRunner {
+    if responses == nil {
+        responses = make(map[string]FakeResponse)
+    }
+    return &FakeRunner{responses: responses}
+}
+
+// LoadFakeRunner reads canned responses from a JSON file mapping function
+// names to {"output": "...", "error": "..."}. The keys "functions" and
+// "<function> --help" override the introspection output.
+func LoadFakeRunner(path string) (*FakeRunner, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    responses := make(map[string]FakeResponse)
+    if err := json.Unmarshal(data, &responses); err != nil {
+        return nil, fmt.Errorf("invalid fixture file %s: %w", path, err)
+    }
+    return NewFakeRunner(responses), nil
+}
+
+// defaultFakeResponses lets the dashboard run without any fixture file
+func defaultFakeResponses() map[string]FakeResponse {
+    return map[string]FakeResponse{
+        "test-connection":             {Output: "ProactivaDev connection OK (fake runner)"},
+        "get-system-status":           {Output: `{"agents":0,"generation":1,"fitness_score":0,"success_rate":0,"active_workflows":0,"memory_usage_mb":0,"components":{}}`},
+        "create-agent":                {Output: "Agent fake-agent (general) initialized (fake runner)"},
+        "create-code-agent":           {Output: "Agent code-agent (code) initialized (fake runner)"},
+        "create-test-agent":           {Output: "Agent test-agent (test) initialized (fake runner)"},
+        "create-security-agent":       {Output: "Agent security-agent (security) initialized (fake runner)"},
+        "create-performance-agent":    {Output: "Agent performance-agent (performance) initialized (fake runner)"},
+        "create-review-agent":         {Output: "Agent review-agent (review) initialized (fake runner)"},
+        "get-agent-metrics":           {Output: `{"tasks_completed":0,"success_rate":0,"avg_duration_ms":0}`},
+        "update-agent-memory":         {Output: "Memory updated (fake runner)"},
+        "execute-agent":               {Output: "Task completed (fake runner)"},
+        "execute-agent-with-retry":    {Output: "Attempt 1 succeeded (fake runner)"},
+        "execute-agent-with-context":  {Output: "Task completed with context (fake runner)"},
+        "execute-agent-with-feedback": {Output: "Task completed after feedback (fake runner)"},
+        "execute-agent-with-llm":      {Output: "Task completed by LLM (fake runner)"},
+        "send-a-2-amessage":           {Output: `{"id":"msg-fake","from":"agent-1","to":"agent-2","type":"QUERY","content":{},"fake":true}`},
+        "initialize-a-2-amesh":        {Output: `{"total_messages":0,"active_channels":0,"fake":true}`},
+        "learn-from-experience":       {Output: `{"experienceId":"exp-fake","insights":[],"recommendations":[],"fake":true}`},
+        "execute-agent-pipeline":      {Output: "Pipeline completed (fake runner)"},
+        "execute-agents-parallel":     {Output: "Parallel execution completed (fake runner)"},
+        "trigger-evolution":           {Output: `{"previousGeneration":1,"newGeneration":2,"mutations":[],"improvements":[],"deprecated":[],"fake":true}`},
+        "export-knowledge":            {Output: "Knowledge exported to: /exports/knowledge-fake.json (fake runner)"},
+        "create-system-snapshot":      {Output: "Snapshot created (fake runner)"},
+        "get-evolution-summary":       {Output: `{"generation":1,"fitness_score":0,"patterns":0,"fake":true}`},
+        "get-fitness-history":         {Output: `{"history":[],"fake":true}`},
+        "generate-system-report":      {Output: "ProactivaDev system report (fake runner)"},
+    }
+}
+
+func (f *FakeRunner) record(function string, args []string) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.invocations = append(f.invocations, DaggerInvocation{
+        Function:  function,
+        Args:      append([]string{}, args...),
+        Timestamp: time.Now().Format(time.RFC3339),
+    })
+}
+
+func (f *FakeRunner) Functions(ctx context.Context) ([]byte, error) {
+    f.record("functions", nil)
+
+    f.mu.Lock()
+    resp, ok := f.responses["functions"]
+    if ok {
+        f.mu.Unlock()
+        return fakeResult(ctx, resp)
+    }
+    defer f.mu.Unlock()
+
+    // Mimic the `dagger functions` layout: one indented line per function
+    names := make([]string, 0, len(f.responses))
+    for name := range f.responses {
+        if !strings.HasSuffix(name, " --help") {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    var b strings.Builder
+    b.WriteString("Name\n")
+    for _, name := range names {
+        b.WriteString("  " + name + "\n")
+    }
+    return []byte(b.String()), nil
+}
+
+// Help answers from the "<function> --help" response, or describes a
+// function without arguments
+func (f *FakeRunner) Help(ctx context.Context, function string) ([]byte, error) {
+    f.record(function, []string{"--help"})
+
+    f.mu.Lock()
+    resp, ok := f.responses[function+" --help"]
+    _, exists := f.responses[function]
+    f.mu.Unlock()
+    if ok {
+        return fakeResult(ctx, resp)
+    }
+    if !exists {
+        return nil, fmt.Errorf("fake runner: no function %s", function)
+    }
+    return []byte(fmt.Sprintf("USAGE\n  dagger call %s\n", function)), ctx.Err()
+}
+
+func (f *FakeRunner) Call(ctx context.Context, function string, args ...string) ([]byte, error) {
+    f.record(function, args)
+
+    f.mu.Lock()
+    resp, ok := f.responses[function]
+    f.mu.Unlock()
+    if !ok {
+        return nil, fmt.Errorf("fake runner: no response recorded for %s", function)
+    }
+    return fakeResult(ctx, resp)
+}
+
+// Invocations returns a copy of every call made so far
+func (f *FakeRunner) Invocations() []DaggerInvocation {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]DaggerInvocation{}, f.invocations...)
+}
+
+// Reset clears the recorded invocations
+func (f *FakeRunner) Reset() {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.invocations = nil
+}
+
+// fakeResult waits out the configured delay, honouring cancellation the
+// same way the CLI runner does
+func fakeResult(ctx context.Context, resp FakeResponse) ([]byte, error) {
+    if resp.DelayMS > 0 {
+        select {
+        case <-time.After(time.Duration(resp.DelayMS) * time.Millisecond):
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        }
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    emitLines(ctx, "stdout", resp.Output)
+    emitLines(ctx, "stderr", resp.Stderr)
+    if resp.Error != "" {
+        return []byte(resp.Output), errors.New(resp.Error)
+    }
+    return []byte(resp.Output), nil
+}
+
+// SimulatedRunner is the synthetic data generator behind --simulate. It
+// never touches Dagger; every status it produces drifts like a live system
+// so the dashboard can be demoed, and every response says it is simulated.
+type SimulatedRunner struct {
+    mu          sync.Mutex
+    rng         *rand.Rand
+    generation  int
+    fitness     float64
+    successRate float64
+}
+
+// simulatedFunctions is the function listing reported in simulation mode
+var simulatedFunctions = []string{
+    "test-connection", "get-system-status", "create-agent", "send-a-2-amessage",
+    "initialize-a-2-amesh", "learn-from-experience", "execute-agent-pipeline",
+    "execute-agents-parallel", "trigger-evolution", "export-knowledge",
+    "create-system-snapshot", "get-evolution-summary", "get-fitness-history",
+    "generate-system-report",
+}
+
+func NewSimulatedRunner() *SimulatedRunner {
+    return &SimulatedRunner{
+        rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+        generation:  1,
+        fitness:     0.5,
+        successRate: 0.7,
+    }
+}
+
+func (sim *SimulatedRunner) Functions(ctx context.Context) ([]byte, error) {
+    var b strings.Builder
+    b.WriteString("Name\n")
+    for _, name := range simulatedFunctions {
+        b.WriteString("  " + name + "\n")
+    }
+    return []byte(b.String()), ctx.Err()
+}
+
+// simulatedArguments is the ARGUMENTS section of each simulated
+// function's --help output
+var simulatedArguments = map[string][]string{
+    "create-agent":            {"--name string   Agent name [required]", "--type string   Agent type [required]"},
+    "send-a-2-amessage":       {"--from-agent string     Sending agent [required]", "--to-agent string       Receiving agent [required]", "--message-type string   Message type (default \"QUERY\")"},
+    "initialize-a-2-amesh":    {"--agents int   Number of agents in the mesh (default 5)"},
+    "learn-from-experience":   {"--experience string   Experience as JSON [required]"},
+    "execute-agent-pipeline":  {"--task string      Task for the pipeline", "--agents strings   Agent types, in order"},
+    "execute-agents-parallel": {"--task string   Task for every agent"},
+    "trigger-evolution":       {"--mutation-rate float       Probability of mutating each trait", "--crossover-rate float      Probability of crossing over two parents", "--elitism-count int         Fittest agents carried over unchanged", "--fitness-threshold float   Minimum fitness an agent needs to survive"},
+    "export-knowledge":        {"--format string   Export format (default \"json\")"},
+    "create-system-snapshot":  {"--name string   Snapshot name [required]"},
+}
+
+func (sim *SimulatedRunner) Help(ctx context.Context, function string) ([]byte, error) {
+    if !slices.Contains(simulatedFunctions, function) {
+        return nil, fmt.Errorf("unknown function %s", function)
+    }
+    var b strings.Builder
+    fmt.Fprintf(&b, "[simulated] %s\n\nUSAGE\n  dagger call %s [arguments]\n", function, function)
+    if args := simulatedArguments[function]; len(args) > 0 {
+        b.WriteString("\nARGUMENTS\n")
+        for _, arg := range args {
+            b.WriteString("      " + arg + "\n")
+        }
+    }
+    return []byte(b.String()), ctx.Err()
+}
+
+func (sim *SimulatedRunner) Call(ctx context.Context, function string, args ...string) ([]byte, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if function == "trigger-evolution" {
+        return sim.evolve(ctx)
+    }
+    if function != "get-system-status" {
+        output := simulatedOutput(function, args)
+        emitLines(ctx, "stdout", output)
+        return []byte(output), nil
+    }
+    
+    sim.mu.Lock()
+    defer sim.mu.Unlock()
+    
+    // Random walk that trends upwards, with an occasional new generation
+    sim.fitness = clamp(sim.fitness+sim.rng.Float64()*0.02-0.005, 0, 1)
+    sim.successRate = clamp(sim.successRate+sim.rng.Float64()*0.02-0.008, 0, 1)
+    if sim.rng.Intn(20) == 0 {
+        sim.generation++
+    }
+    
+    doc := map[string]interface{}{
+        "agents":           5,
+        "generation":       sim.generation,
+        "fitness_score":    sim.fitness,
+        "success_rate":     sim.successRate,
+        "active_workflows": sim.rng.Intn(5),
+        "memory_usage_mb":  40 + sim.rng.Float64()*10,
+        "components": map[string]Component{
+            "agent_memory":      {Status: "simulated", SizeMB: 12.5 + sim.rng.Float64()*2},
+            "a2a_mesh":          {Status: "simulated", SizeMB: 8.3 + sim.rng.Float64()},
+            "collective_memory": {Status: "simulated", SizeMB: 15.7 + sim.rng.Float64()*3},
+        },
+    }
+    return json.Marshal(doc)
+}
+
+// simulatedOutput answers a call in the shape the real module prints, so
+// suite assertions hold in simulation mode, filled in from the call's own
+// flags. Text is prefixed [simulated]; JSON carries "simulated": true so it
+// still parses.
+func simulatedOutput(function string, args []string) string {
+    flag := func(name, fallback string) string {
+        if value := flagValue(args, name); value != "" {
+            return value
+        }
+        return fallback
+    }
+    
+    var doc map[string]interface{}
+    switch {
+    case function == "create-agent":
+        return fmt.Sprintf("[simulated] Agent %s (%s) initialized", flag("--name", "agent"), flag("--type", "general"))
+    case strings.HasPrefix(function, "create-") && strings.HasSuffix(function, "-agent"):
+        kind := strings.TrimSuffix(strings.TrimPrefix(function, "create-"), "-agent")
+        return fmt.Sprintf("[simulated] Agent %s (%s) initialized", flag("--name", kind+"-agent"), kind)
+    case function == "send-a-2-amessage":
+        doc = map[string]interface{}{
+            "id":   fmt.Sprintf("msg-%d", time.Now().UnixMilli()),
+            "from": flag("--from-agent", ""),
+            "to":   flag("--to-agent", ""),
+            "type": flag("--message-type", "QUERY"),
+        }
+    case function == "initialize-a-2-amesh":
+        doc = map[string]interface{}{"total_messages": 0, "active_channels": 0}
+    case function == "learn-from-experience":
+        doc = map[string]interface{}{
+            "experienceId":    fmt.Sprintf("exp-%d", time.Now().UnixMilli()),
+            "insights":        []string{},
+            "recommendations": []string{},
+        }
+    default:
+        return fmt.Sprintf("[simulated] %s %s", function, strings.Join(args, " "))
+    }
+    doc["simulated"] = true
+    data, _ := json.Marshal(doc)
+    return string(data)
+}
+
+// evolve advances the simulated population a generation, so the dashboard's
+// evolve action shows up in the next status
+func (sim *SimulatedRunner) evolve(ctx context.Context) ([]byte, error) {
+    sim.mu.Lock()
+    sim.generation++
+    sim.fitness = clamp(sim.fitness+sim.rng.Float64()*0.05, 0, 1)
+    output, _ := json.Marshal(map[string]interface{}{
+        "previousGeneration": sim.generation - 1,
+        "newGeneration":      sim.generation,
+        "mutations":          []string{},
+        "improvements":       []string{},
+        "deprecated":         []string{},
+        "simulated":          true,
+    })
+    sim.mu.Unlock()
+    emitLines(ctx, "stdout", string(output))
+    return output, nil
+}
+
+func clamp(v, lo, hi float64) float64 {
+    if v < lo {
+        return lo
+    }
+    if v > hi {
+        return hi
+    }
+    return v
+}
+
+// GraphQLRunner talks to a Dagger engine session's GraphQL API instead of
+// spawning the CLI. It serves the module into the session once, answers
+// Functions and Help in the CLI's layout from the module's type
+// definitions, and translates Call's CLI-style flags into a typed query.
+type GraphQLRunner struct {
+    URL    string
+    Token  string
+    Module string
+    Client *http.Client
+    
+    serveMu sync.Mutex
+    served  bool
+    
+    mu     sync.Mutex
+    module *gqlModule
+}
+
+// gqlTypeDef is the part of a Dagger TypeDef the runner needs. Kind is one
+// of STRING_KIND, INTEGER_KIND, FLOAT_KIND, BOOLEAN_KIND, LIST_KIND,
+// OBJECT_KIND, ENUM_KIND, SCALAR_KIND, VOID_KIND, ...
+type gqlTypeDef struct {
+    Kind     string `json:"kind"`
+    Optional bool   `json:"optional"`
+    AsObject *struct {
+        Name string `json:"name"`
+    } `json:"asObject"`
+    AsEnum *struct {
+        Name   string `json:"name"`
+        Values []struct {
+            Name string `json:"name"`
+        } `json:"values"`
+    } `json:"asEnum"`
+    AsList *struct {
+        ElementTypeDef *gqlTypeDef `json:"elementTypeDef"`
+    } `json:"asList"`
+}
+
+type gqlFunction struct {
+    Name        string `json:"name"`
+    Description string `json:"description"`
+    Args        []struct {
+        Name         string     `json:"name"`
+        Description  string     `json:"description"`
+        DefaultValue *string    `json:"defaultValue"`
+        TypeDef      gqlTypeDef `json:"typeDef"`
+    } `json:"args"`
+    ReturnType gqlTypeDef `json:"returnType"`
+}
+
+type gqlModule struct {
+    Name    string `json:"name"`
+    Objects []struct {
+        AsObject *struct {
+            Name      string        `json:"name"`
+            Functions []gqlFunction `json:"functions"`
+        } `json:"asObject"`
+    } `json:"objects"`
+}
+
+var gqlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const gqlTypeDefFields = `kind optional asObject { name } asEnum { name values { name } }`
+
+var gqlModuleQuery = `query($ref: String!) { moduleSource(refString: $ref) { asModule {
+  name
+  objects { asObject { name functions {
+    name description
+    args { name description defaultValue typeDef { ` + gqlTypeDefFields + ` asList { elementTypeDef { ` + gqlTypeDefFields + ` } } } }
+    returnType { ` + gqlTypeDefFields + ` asList { elementTypeDef { ` + gqlTypeDefFields + ` } } }
+  } } }
+} } }`
+
+// NewGraphQLRunnerFromEnv connects to the session of an enclosing
+// `dagger run` (DAGGER_SESSION_PORT and DAGGER_SESSION_TOKEN), or to
+// PROACTIVA_DAGGER_GRAPHQL_URL, e.g. a local stand-in server. The module
+// comes from PROACTIVA_DAGGER_MODULE (default ".").
+func NewGraphQLRunnerFromEnv() (*GraphQLRunner, error) {
+    runner := &GraphQLRunner{
+        URL:    os.Getenv("PROACTIVA_DAGGER_GRAPHQL_URL"),
+        Token:  os.Getenv("DAGGER_SESSION_TOKEN"),
+        Module: os.Getenv("PROACTIVA_DAGGER_MODULE"),
+        Client: &http.Client{},
+    }
+    if runner.URL == "" {
+        port := os.Getenv("DAGGER_SESSION_PORT")
+        if port == "" {
+            return nil, errors.New("graphql runner needs DAGGER_SESSION_PORT (start the server under `dagger run`) or PROACTIVA_DAGGER_GRAPHQL_URL")
+        }
+        runner.URL = "http://127.0.0.1:" + port + "/query"
+    }
+    if runner.Module == "" {
+        runner.Module = "."
+    }
+    return runner, nil
+}
+
+// GraphQLError is an error the engine reported for a query
+type GraphQLError struct {
+    Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+    return strings.Join(e.Messages, "; ")
+}
+
+// query posts a GraphQL query and decodes its data into out
+func (g *GraphQLRunner) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+    body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if g.Token != "" {
+        req.SetBasicAuth(g.Token, "")
+    }
+    // The engine joins its spans to the caller's trace, as with the CLI
+    if span := SpanFromContext(ctx); span != nil {
+        req.Header.Set("traceparent", span.Traceparent())
+    }
+    
+    resp, err := g.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+    
+    var result struct {
+        Data   json.RawMessage `json:"data"`
+        Errors []struct {
+            Message string `json:"message"`
+        } `json:"errors"`
+    }
+    if err := json.Unmarshal(data, &result); err != nil {
+        return fmt.Errorf("dagger engine answered %s: %s", resp.Status, bytes.TrimSpace(data))
+    }
+    if len(result.Errors) > 0 {
+        gqlErr := &GraphQLError{}
+        for _, e := range result.Errors {
+            gqlErr.Messages = append(gqlErr.Messages, e.Message)
+        }
+        return gqlErr
+    }
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("dagger engine answered %s", resp.Status)
+    }
+    return json.Unmarshal(result.Data, out)
+}
+
+// serve loads the module into the engine session once; callers arriving
+// while the first attempt is in flight wait for it
+func (g *GraphQLRunner) serve(ctx context.Context) error {
+    g.serveMu.Lock()
+    defer g.serveMu.Unlock()
+    if g.served {
+        return nil
+    }
+    
+    var served json.RawMessage
+    variables := map[string]interface{}{"ref": g.Module}
+    if err := g.query(ctx, `query($ref: String!) { moduleSource(refString: $ref) { asModule { serve } } }`, variables, &served); err != nil {
+        return fmt.Errorf("loading module %s: %w", g.Module, err)
+    }
+    g.served = true
+    return nil
+}
+
+// load serves the module into the session on first use and returns its
+// type definitions, fetching them again when refresh is set. The schema
+// request runs without holding g.mu, so a refresh never blocks calls that
+// can use the cached definitions; the lock only guards swapping them in.
+func (g *GraphQLRunner) load(ctx context.Context, refresh bool) (*gqlModule, error) {
+    if err := g.serve(ctx); err != nil {
+        return nil, err
+    }
+    g.mu.Lock()
+    module := g.module
+    g.mu.Unlock()
+    if module != nil && !refresh {
+        return module, nil
+    }
+    
+    var data struct {
+        ModuleSource struct {
+            AsModule gqlModule `json:"asModule"`
+        } `json:"moduleSource"`
+    }
+    if err := g.query(ctx, gqlModuleQuery, map[string]interface{}{"ref": g.Module}, &data); err != nil {
+        return nil, fmt.Errorf("introspecting module %s: %w", g.Module, err)
+    }
+    module = &data.ModuleSource.AsModule
+    g.mu.Lock()
+    g.module = module
+    g.mu.Unlock()
+    return module, nil
+}
+
+// functions returns the functions of the module's main object, the ones
+// `dagger call` exposes
+func (m *gqlModule) functions() []gqlFunction {
+    for _, object := range m.Objects {
+        if object.AsObject != nil && gqlKey(object.AsObject.Name) == gqlKey(m.Name) {
+            return object.AsObject.Functions
+        }
+    }
+    return nil
+}
+
+// function finds a module function by its CLI name
+func (m *gqlModule) function(name string) (gqlFunction, error) {
+    for _, function := range m.functions() {
+        if gqlKey(function.Name) == gqlKey(name) {
+            return function, nil
+        }
+    }
+    return gqlFunction{}, fmt.Errorf("module %s has no function %s", m.Name, name)
+}
+
+// gqlKey folds CLI (kebab-case) and GraphQL (camelCase) names to the same
+// key, so a function is found however its name was cased
+func gqlKey(name string) string {
+    return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
+
+// kebabCase renders a GraphQL name the way the CLI does: a dash after a
+// lower-case letter or digit that is followed by another kind of
+// character, and between an upper-case letter and a digit. Acronyms are
+// not split, so initializeA2AMesh becomes initialize-a-2-amesh.
+func kebabCase(name string) string {
+    kind := func(c byte) int {
+        switch {
+        case c >= 'a' && c <= 'z':
+            return 'a'
+        case c >= 'A' && c <= 'Z':
+            return 'A'
+        case c >= '0' && c <= '9':
+            return '0'
+        }
+        return 0
+    }
+    var b strings.Builder
+    for i := 0; i < len(name); i++ {
+        c := name[i]
+        if kind(c) == 'A' {
+            c += 'a' - 'A'
+        }
+        b.WriteByte(c)
+        if i+1 == len(name) {
+            continue
+        }
+        this, next := kind(name[i]), kind(name[i+1])
+        if this != 0 && next != 0 && this != next && (this != 'A' || next == '0') {
+            b.WriteByte('-')
+        }
+    }
+    return b.String()
+}
+
+// camelCase turns a CLI field name such as with-exec into withExec
+func camelCase(name string) string {
+    parts := strings.Split(name, "-")
+    for i := 1; i < len(parts); i++ {
+        if parts[i] != "" {
+            parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+        }
+    }
+    return strings.Join(parts, "")
+}
+
+// cliType is how `dagger call --help` shows a type; booleans show none
+func (t gqlTypeDef) cliType() string {
+    switch t.Kind {
+    case "STRING_KIND", "SCALAR_KIND":
+        return "string"
+    case "INTEGER_KIND":
+        return "int"
+    case "FLOAT_KIND":
+        return "float"
+    case "BOOLEAN_KIND":
+        return ""
+    case "LIST_KIND":
+        if t.AsList != nil && t.AsList.ElementTypeDef != nil {
+            if elem := t.AsList.ElementTypeDef.cliType(); elem != "" {
+                return elem + "s"
+            }
+            return "bools"
+        }
+    case "OBJECT_KIND":
+        if t.AsObject != nil {
+            return t.AsObject.Name
+        }
+    case "ENUM_KIND":
+        if t.AsEnum != nil {
+            return t.AsEnum.Name
+        }
+    }
+    return strings.ToLower(strings.TrimSuffix(t.Kind, "_KIND"))
+}
+
+// literal renders a CLI flag value as a GraphQL literal of this type
+func (t gqlTypeDef) literal(value string) (string, error) {
+    switch t.Kind {
+    case "STRING_KIND", "SCALAR_KIND":
+        quoted, err := json.Marshal(value)
+        return string(quoted), err
+    case "INTEGER_KIND":
+        if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+            return "", fmt.Errorf("%q is not an integer", value)
+        }
+        return value, nil
+    case "FLOAT_KIND":
+        if _, err := strconv.ParseFloat(value, 64); err != nil {
+            return "", fmt.Errorf("%q is not a number", value)
+        }
+        return value, nil
+    case "BOOLEAN_KIND":
+        b, err := strconv.ParseBool(value)
+        if err != nil {
+            return "", fmt.Errorf("%q is not a boolean", value)
+        }
+        return strconv.FormatBool(b), nil
+    case "ENUM_KIND":
+        if !gqlNamePattern.MatchString(value) {
+            return "", fmt.Errorf("%q is not an enum value", value)
+        }
+        return value, nil
+    case "LIST_KIND":
+        if t.AsList == nil || t.AsList.ElementTypeDef == nil {
+            break
+        }
+        // A JSON array such as ["code","test"] keeps commas inside its
+        // items; anything else is the CLI's comma separated form
+        elements := strings.Split(value, ",")
+        var decoded []interface{}
+        if json.Unmarshal([]byte(value), &decoded) == nil {
+            elements = make([]string, len(decoded))
+            for i, element := range decoded {
+                if text, ok := element.(string); ok {
+                    elements[i] = text
+                } else {
+                    encoded, _ := json.Marshal(element)
+                    elements[i] = string(encoded)
+                }
+            }
+        }
+        var items []string
+        for _, item := range elements {
+            lit, err := t.AsList.ElementTypeDef.literal(item)
+            if err != nil {
+                return "", err
+            }
+            items = append(items, lit)
+        }
+        return "[" + strings.Join(items, ", ") + "]", nil
+    }
+    return "", fmt.Errorf("%s arguments are not supported by the graphql runner", t.cliType())
+}
+
+// Functions renders the module's functions in the `dagger functions` layout
+func (g *GraphQLRunner) Functions(ctx context.Context) ([]byte, error) {
+    module, err := g.load(ctx, true)
+    if err != nil {
+        return nil, err
+    }
+    var b strings.Builder
+    b.WriteString("Name   Description\n")
+    for _, function := range module.functions() {
+        description, _, _ := strings.Cut(strings.TrimSpace(function.Description), "\n")
+        if description == "" {
+            description = "-"
+        }
+        fmt.Fprintf(&b, "%s   %s\n", kebabCase(function.Name), description)
+    }
+    return []byte(b.String()), nil
+}
+
+// Help renders a function's signature in the `dagger call --help` layout
+func (g *GraphQLRunner) Help(ctx context.Context, function string) ([]byte, error) {
+    module, err := g.load(ctx, false)
+    if err != nil {
+        return nil, err
+    }
+    fn, err := module.function(function)
+    if err != nil {
+        return nil, err
+    }
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, "%s\n\nUSAGE\n  dagger call %s [arguments]\n", strings.TrimSpace(fn.Description), kebabCase(fn.Name))
+    if len(fn.Args) > 0 {
+        b.WriteString("\nARGUMENTS\n")
+    }
+    for _, arg := range fn.Args {
+        description := strings.Join(strings.Fields(arg.Description), " ")
+        if arg.TypeDef.AsEnum != nil {
+            var values []string
+            for _, v := range arg.TypeDef.AsEnum.Values {
+                values = append(values, v.Name)
+            }
+            description += " (possible values: " + strings.Join(values, ", ") + ")"
+        }
+        if arg.DefaultValue != nil {
+            description += " (default " + *arg.DefaultValue + ")"
+        } else if !arg.TypeDef.Optional {
+            description += " [required]"
+        }
+        flag := "--" + kebabCase(arg.Name)
+        if cliType := arg.TypeDef.cliType(); cliType != "" {
+            flag += " " + cliType
+        }
+        fmt.Fprintf(&b, "      %s   %s\n", flag, strings.TrimSpace(description))
+    }
+    return []byte(b.String()), nil
+}
+
+// Call runs a module function from CLI-style arguments: --flag value (or
+// --flag=value) arguments, then optional field names to select on the
+// result, as in `dagger call learn-from-experience --experience ... stdout`.
+// Scalars are returned as text, lists and objects as JSON.
+func (g *GraphQLRunner) Call(ctx context.Context, function string, args ...string) ([]byte, error) {
+    module, err := g.load(ctx, false)
+    if err != nil {
+        return nil, err
+    }
+    // The query starts from the module's object, named after the module
+    if module.Name == "" {
+        return nil, fmt.Errorf("module %s has no name; its schema did not load", g.Module)
+    }
+    fn, err := module.function(function)
+    if err != nil {
+        return nil, err
+    }
+    
+    var literals, chain []string
+    for i := 0; i < len(args); i++ {
+        if !strings.HasPrefix(args[i], "--") {
+            chain = append(chain, camelCase(args[i]))
+            continue
+        }
+        name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+        arg := -1
+        for j := range fn.Args {
+            if gqlKey(fn.Args[j].Name) == gqlKey(name) {
+                arg = j
+            }
+        }
+        if arg < 0 {
+            return nil, fmt.Errorf("%s has no argument --%s", function, name)
+        }
+        typeDef := fn.Args[arg].TypeDef
+        switch {
+        case hasValue:
+        case typeDef.Kind == "BOOLEAN_KIND":
+            value = "true"
+        case i+1 < len(args):
+            i++
+            value = args[i]
+        default:
+            return nil, fmt.Errorf("--%s needs a value", name)
+        }
+        literal, err := typeDef.literal(value)
+        if err != nil {
+            return nil, fmt.Errorf("--%s: %w", name, err)
+        }
+        literals = append(literals, fn.Args[arg].Name+": "+literal)
+    }
+    
+    // Objects need a field selected; id makes the engine evaluate them
+    selection := fn.Name
+    if len(literals) > 0 {
+        selection += "(" + strings.Join(literals, ", ") + ")"
+    }
+    evaluate := len(chain) == 0 && fn.ReturnType.Kind == "OBJECT_KIND"
+    if evaluate {
+        chain = []string{"id"}
+    }
+    path := append([]string{strings.ToLower(module.Name[:1]) + module.Name[1:], fn.Name}, chain...)
+    query := "query { " + path[0] + " { " + selection
+    for _, field := range chain {
+        query += " { " + field
+    }
+    query += strings.Repeat(" }", len(chain)+2)
+    
+    var data interface{}
+    if err := g.query(ctx, query, nil, &data); err != nil {
+        return nil, err
+    }
+    for _, field := range path {
+        object, ok := data.(map[string]interface{})
+        if !ok {
+            return nil, fmt.Errorf("unexpected result for %s: %v", function, data)
+        }
+        data = object[field]
+    }
+    
+    var output []byte
+    switch value := data.(type) {
+    case string:
+        output = []byte(value)
+    case nil:
+    default:
+        output, _ = json.Marshal(value)
+    }
+    if evaluate {
+        output = []byte(fn.ReturnType.cliType() + " evaluated")
+    }
+    emitLines(ctx, "stdout", string(output))
+    return output, nil
+}
+
+// newRunner selects the Dagger backend. Simulation mode always uses the
+// SimulatedRunner; otherwise PROACTIVA_DAGGER_RUNNER=fake uses the
+// FakeRunner, loading PROACTIVA_DAGGER_FIXTURES when set, and
+// PROACTIVA_DAGGER_RUNNER=graphql the engine session's GraphQL API.
+func newRunner(cfg ServerConfig) (DaggerRunner, error) {
+    if cfg.Simulate {
+        return NewSimulatedRunner(), nil
+    }
+    
+    switch os.Getenv("PROACTIVA_DAGGER_RUNNER") {
+    case "", "cli":
+        return NewCLIRunner(), nil
+    case "fake":
+        if path := os.Getenv("PROACTIVA_DAGGER_FIXTURES"); path != "" {
+            return LoadFakeRunner(path)
+        }
+        return NewFakeRunner(defaultFakeResponses()), nil
+    case "graphql":
+        return NewGraphQLRunnerFromEnv()
+    default:
+        return nil, fmt.Errorf("unknown PROACTIVA_DAGGER_RUNNER: %s", os.Getenv("PROACTIVA_DAGGER_RUNNER"))
+    }
+}
+
+// DaggerTimeouts bounds how long each Dagger function may run
+type DaggerTimeouts struct {
+    Default   time.Duration
+    Functions map[string]time.Duration
+}
+
+func defaultDaggerTimeouts() DaggerTimeouts {
+    return DaggerTimeouts{
+        Default: 2 * time.Minute,
+        Functions: map[string]time.Duration{
+            "functions":               30 * time.Second,
+            "test-connection":         time.Minute,
+            "get-system-status":       30 * time.Second,
+            "execute-agent-pipeline":  10 * time.Minute,
+            "execute-agents-parallel": 15 * time.Minute,
+        },
+    }
+}
+
+// For returns the deadline for a function, falling back to Default
+func (t DaggerTimeouts) For(function string) time.Duration {
+    if d, ok := t.Functions[function]; ok {
+        return d
+    }
+    return t.Default
+}
+
+// loadDaggerTimeouts applies PROACTIVA_DAGGER_TIMEOUT (default deadline) and
+// PROACTIVA_DAGGER_TIMEOUTS ("fn=10m,other=30s") on top of the defaults
+func loadDaggerTimeouts() (DaggerTimeouts, error) {
+    timeouts := defaultDaggerTimeouts()
+    
+    if v := os.Getenv("PROACTIVA_DAGGER_TIMEOUT"); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil {
+            return timeouts, fmt.Errorf("invalid PROACTIVA_DAGGER_TIMEOUT: %w", err)
+        }
+        timeouts.Default = d
+    }
+    
+    if v := os.Getenv("PROACTIVA_DAGGER_TIMEOUTS"); v != "" {
+        for _, pair := range strings.Split(v, ",") {
+            name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+            if !ok {
+                return timeouts, fmt.Errorf("invalid PROACTIVA_DAGGER_TIMEOUTS entry: %q", pair)
+            }
+            d, err := time.ParseDuration(value)
+            if err != nil {
+                return timeouts, fmt.Errorf("invalid timeout for %s: %w", name, err)
+            }
+            timeouts.Functions[name] = d
+        }
+    }
+    
+    return timeouts, nil
+}
+
+// Invocation outcomes reported in API responses
+const (
+    InvocationOK        = "ok"
+    InvocationFailed    = "failed"
+    InvocationTimedOut  = "timed_out"
+    InvocationCancelled = "cancelled"
+)
+
+// DaggerError describes a failed Dagger invocation
+type DaggerError struct {
+    Function string
+    Status   string
+    Timeout  time.Duration
+    Err      error
+}
+
+func (e *DaggerError) Error() string {
+    switch e.Status {
+    case InvocationTimedOut:
+        return fmt.Sprintf("%s timed out after %s", e.Function, e.Timeout)
+    case InvocationCancelled:
+        return fmt.Sprintf("%s cancelled", e.Function)
+    default:
+        if tail := stderrTail(e.Err); tail != "" {
+            return fmt.Sprintf("%s failed: %v: %s", e.Function, e.Err, tail)
+        }
+        return fmt.Sprintf("%s failed: %v", e.Function, e.Err)
+    }
+}
+
+// stderrTail returns the last line dagger wrote to stderr before exiting
+// with an error, which is usually the one that explains it
+func stderrTail(err error) string {
+    var exitErr *exec.ExitError
+    if !errors.As(err, &exitErr) {
+        return ""
+    }
+    lines := strings.Split(strings.TrimSpace(string(exitErr.Stderr)), "\n")
+    return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func (e *DaggerError) Unwrap() error {
+    return e.Err
+}
+
+// invocationStatus maps an error returned by Server.call to its outcome
+func invocationStatus(err error) string {
+    if err == nil {
+        return InvocationOK
+    }
+    var daggerErr *DaggerError
+    if errors.As(err, &daggerErr) {
+        return daggerErr.Status
+    }
+    return InvocationFailed
+}
+
+// ServerConfig collects the tunables read from the environment at startup
+type ServerConfig struct {
+    Timeouts         DaggerTimeouts
+    StatusInterval   time.Duration
+    Simulate         bool
+    DataDir          string
+    MetricsRetention time.Duration
+    RunsRetention    time.Duration
+    OTLPEndpoint     string
+    TraceFile        string
+    EventReplay      int
+    EventLog         string
+    SSERetry         time.Duration
+    SSEHeartbeat     time.Duration
+    MaxConcurrent    int
+    QueueSize        int
+    TestSuites       string
+    AllowedOrigins   []string
+}
+
+// loadServerConfig reads ServerConfig from PROACTIVA_* environment variables
+func loadServerConfig() (ServerConfig, error) {
+    cfg := ServerConfig{
+        StatusInterval:   5 * time.Second,
+        DataDir:          ".proactiva",
+        MetricsRetention: 7 * 24 * time.Hour,
+        RunsRetention:    30 * 24 * time.Hour,
+        EventReplay:      1000,
+        SSERetry:         3 * time.Second,
+        SSEHeartbeat:     15 * time.Second,
+        MaxConcurrent:    4,
+        QueueSize:        32,
+        TestSuites:       "test-suites.json",
+    }
+    if _, err := os.Stat("/app/test-suites.json"); err == nil {
+        cfg.TestSuites = "/app/test-suites.json"
+    }
+    
+    if v := os.Getenv("PROACTIVA_DATA_DIR"); v != "" {
+        cfg.DataDir = v
+    }
+    
+    cfg.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+    cfg.TraceFile = os.Getenv("PROACTIVA_TRACE_FILE")
+    
+    if err := envDuration("PROACTIVA_METRICS_RETENTION", &cfg.MetricsRetention); err != nil {
+        return cfg, err
+    }
+    if err := envDuration("PROACTIVA_RUNS_RETENTION", &cfg.RunsRetention); err != nil {
+        return cfg, err
+    }
+    if err := envDuration("PROACTIVA_SSE_RETRY", &cfg.SSERetry); err != nil {
+        return cfg, err
+    }
+    if err := envDuration("PROACTIVA_SSE_HEARTBEAT", &cfg.SSEHeartbeat); err != nil {
+        return cfg, err
+    }
+    if err := envInt("PROACTIVA_EVENT_REPLAY", &cfg.EventReplay); err != nil {
+        return cfg, err
+    }
+    if err := envInt("PROACTIVA_MAX_CONCURRENCY", &cfg.MaxConcurrent); err != nil {
+        return cfg, err
+    }
+    if cfg.MaxConcurrent < 1 {
+        return cfg, fmt.Errorf("invalid PROACTIVA_MAX_CONCURRENCY: must be at least 1")
+    }
+    if err := envInt("PROACTIVA_QUEUE_SIZE", &cfg.QueueSize); err != nil {
+        return cfg, err
+    }
+    if v := os.Getenv("PROACTIVA_EVENT_LOG"); v != "" {
+        cfg.EventLog = v
+    }
+    if v := os.Getenv("PROACTIVA_TEST_SUITES"); v != "" {
+        cfg.TestSuites = v
+    }
+    for _, origin := range strings.Split(os.Getenv("PROACTIVA_ALLOWED_ORIGINS"), ",") {
+        if origin = strings.TrimSpace(origin); origin != "" {
+            cfg.AllowedOrigins = append(cfg.AllowedOrigins, strings.TrimSuffix(origin, "/"))
+        }
+    }
+    
+    switch v := os.Getenv("PROACTIVA_SIMULATE"); v {
+    case "", "0", "false":
+    case "1", "true":
+        cfg.Simulate = true
+    default:
+        return cfg, fmt.Errorf("invalid PROACTIVA_SIMULATE: %q", v)
+    }
+    
+    timeouts, err := loadDaggerTimeouts()
+    if err != nil {
+        return cfg, err
+    }
+    cfg.Timeouts = timeouts
+    
+    if err := envDuration("PROACTIVA_STATUS_INTERVAL", &cfg.StatusInterval); err != nil {
+        return cfg, err
+    }
+    
+    return cfg, nil
+}
+
+// envDuration overwrites dst with a positive duration from the environment
+func envDuration(name string, dst *time.Duration) error {
+    v := os.Getenv(name)
+    if v == "" {
+        return nil
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil || d <= 0 {
+        return fmt.Errorf("invalid %s: %q", name, v)
+    }
+    *dst = d
+    return nil
+}
+
+// envInt overwrites dst with a positive integer from the environment
+func envInt(name string, dst *int) error {
+    v := os.Getenv(name)
+    if v == "" {
+        return nil
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n <= 0 {
+        return fmt.Errorf("invalid %s: %q", name, v)
+    }
+    *dst = n
+    return nil
+}
+
+// StatusCache holds the latest SystemStatus snapshot. A single background
+// poller refreshes it and concurrent refreshes share one in-flight fetch, so
+// the number of Dagger processes no longer scales with connected clients.
+type StatusCache struct {
+    fetch    func(ctx context.Context) SystemStatus
+    interval time.Duration
+    
+    mu        sync.Mutex
+    snapshot  SystemStatus
+    updated   time.Time
+    flight    *statusFlight
+    listeners []func(SystemStatus)
+}
+
+// statusFlight is a refresh in progress that late callers wait on
+type statusFlight struct {
+    done   chan struct{}
+    status SystemStatus
+}
+
+func NewStatusCache(fetch func(ctx context.Context) SystemStatus, interval time.Duration) *StatusCache {
+    return &StatusCache{fetch: fetch, interval: interval}
+}
+
+// Get returns the cached snapshot with its age filled in, fetching one first
+// if the poller has not produced any yet
+func (c *StatusCache) Get(ctx context.Context) SystemStatus {
+    c.mu.Lock()
+    status, updated := c.snapshot, c.updated
+    c.mu.Unlock()
+    
+    if updated.IsZero() {
+        status = c.Refresh(ctx)
+        updated = time.Now()
+    }
+    status.SnapshotAgeMS = time.Since(updated).Milliseconds()
+    return status
+}
+
+// Refresh fetches a new snapshot, joining a fetch already in flight instead
+// of starting another one
+func (c *StatusCache) Refresh(ctx context.Context) SystemStatus {
+    c.mu.Lock()
+    if f := c.flight; f != nil {
+        c.mu.Unlock()
+        select {
+        case <-f.done:
+            return f.status
+        case <-ctx.Done():
+            return c.current()
+        }
+    }
+    f := &statusFlight{done: make(chan struct{})}
+    c.flight = f
+    c.mu.Unlock()
+    
+    // The fetch is shared, so it must not die with whichever caller started it
+    f.status = c.fetch(context.Background())
+    
+    c.mu.Lock()
+    c.snapshot = f.status
+    c.updated = time.Now()
+    c.flight = nil
+    listeners := append([]func(SystemStatus){}, c.listeners...)
+    c.mu.Unlock()
+    close(f.done)
+    
+    for _, listener := range listeners {
+        listener(f.status)
+    }
+    
+    return f.status
+}
+
+// OnUpdate registers fn to be called with every freshly fetched snapshot
+func (c *StatusCache) OnUpdate(fn func(SystemStatus)) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.listeners = append(c.listeners, fn)
+}
+
+func (c *StatusCache) current() SystemStatus {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.snapshot
+}
+
+// Run refreshes the snapshot every interval until ctx is done
+func (c *StatusCache) Run(ctx context.Context) {
+    c.Refresh(ctx)
+    
+    ticker := time.NewTicker(c.interval)
+    defer ticker.Stop()
+    
+    for {
+        select {
+        case <-ticker.C:
+            c.Refresh(ctx)
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// MetricsStore is an append-only on-disk time series of MetricsData
+// samples. Samples are kept in memory for querying and appended as JSON
+// lines to a file so history survives restarts; Compact rewrites the file
+// without samples older than the retention period.
+type MetricsStore struct {
+    path      string
+    retention time.Duration
+    
+    mu      sync.Mutex
+    file    *os.File
+    samples []metricsSample
+}
+
+type metricsSample struct {
+    time time.Time
+    data MetricsData
+}
+
+// OpenMetricsStore loads existing samples from path, creating it if needed
+func OpenMetricsStore(path string, retention time.Duration) (*MetricsStore, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return nil, err
+    }
+    
+    store := &MetricsStore{path: path, retention: retention}
+    if err := store.load(); err != nil {
+        return nil, err
+    }
+    return store, nil
+}
+
+func (m *MetricsStore) load() error {
+    file, err := os.Open(m.path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        var data MetricsData
+        if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+            // A torn final line from a crash is skipped, not fatal
+            log.Printf("metrics store: skipping corrupt sample in %s: %v", m.path, err)
+            continue
+        }
+        t, err := time.Parse(time.RFC3339Nano, data.Timestamp)
+        if err != nil {
+            continue
+        }
+        m.samples = append(m.samples, metricsSample{time: t, data: data})
+    }
+    sort.SliceStable(m.samples, func(i, j int) bool {
+        return m.samples[i].time.Before(m.samples[j].time)
+    })
+    return scanner.Err()
+}
+
+// Append records a sample at t
+func (m *MetricsStore) Append(t time.Time, data MetricsData) error {
+    data.Timestamp = t.UTC().Format(time.RFC3339Nano)
+    line, err := json.Marshal(data)
+    if err != nil {
+        return err
+    }
+    
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    
+    if m.file == nil {
+        m.file, err = os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+        if err != nil {
+            return err
+        }
+    }
+    if _, err := m.file.Write(append(line, '\n')); err != nil {
+        return err
+    }
+    m.samples = append(m.samples, metricsSample{time: t, data: data})
+    return nil
+}
+
+// Compact drops samples older than the retention period from memory and
+// atomically rewrites the file with the survivors
+func (m *MetricsStore) Compact() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    
+    cutoff := time.Now().Add(-m.retention)
+    keep := sort.Search(len(m.samples), func(i int) bool {
+        return !m.samples[i].time.Before(cutoff)
+    })
+    m.samples = append([]metricsSample{}, m.samples[keep:]...)
+    
+    tmp := m.path + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    writer := bufio.NewWriter(out)
+    encoder := json.NewEncoder(writer)
+    for _, sample := range m.samples {
+        if err := encoder.Encode(sample.data); err != nil {
+            out.Close()
+            return err
+        }
+    }
+    if err := writer.Flush(); err != nil {
+        out.Close()
+        return err
+    }
+    if err := out.Close(); err != nil {
+        return err
+    }
+    
+    if m.file != nil {
+        m.file.Close()
+        m.file = nil
+    }
+    return os.Rename(tmp, m.path)
+}
+
+// Query returns samples in [from, to]. With a positive step samples are
+// averaged into step-aligned buckets, stamped with the bucket start.
+func (m *MetricsStore) Query(from, to time.Time, step time.Duration) []MetricsData {
+    m.mu.Lock()
+    start := sort.Search(len(m.samples), func(i int) bool {
+        return !m.samples[i].time.Before(from)
+    })
+    end := sort.Search(len(m.samples), func(i int) bool {
+        return m.samples[i].time.After(to)
+    })
+    var window []metricsSample
+    if start < end {
+        window = append(window, m.samples[start:end]...)
+    }
+    m.mu.Unlock()
+    
+    result := []MetricsData{}
+    if step <= 0 {
+        for _, sample := range window {
+            result = append(result, sample.data)
+        }
+        return result
+    }
+    
+    for i := 0; i < len(window); {
+        bucket := window[i].time.Truncate(step)
+        next := bucket.Add(step)
+        
+        var sum MetricsData
+        tasks, n := 0, 0
+        for ; i < len(window) && window[i].time.Before(next); i++ {
+            sum.SuccessRate += window[i].data.SuccessRate
+            sum.Fitness += window[i].data.Fitness
+            sum.MemoryMB += window[i].data.MemoryMB
+            tasks += window[i].data.TaskCount
+            n++
+        }
+        
+        result = append(result, MetricsData{
+            Timestamp:   bucket.UTC().Format(time.RFC3339),
+            SuccessRate: sum.SuccessRate / float64(n),
+            Fitness:     sum.Fitness / float64(n),
+            TaskCount:   int(math.Round(float64(tasks) / float64(n))),
+            MemoryMB:    sum.MemoryMB / float64(n),
+        })
+    }
+    return result
+}
+
+// RunCompaction compacts the store now and then every interval until ctx
+// is done
+func (m *MetricsStore) RunCompaction(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    
+    for {
+        if err := m.Compact(); err != nil {
+            log.Printf("metrics store: compaction failed: %v", err)
+        }
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// recordStatus stores a sample for every snapshot whose chart fields are
+// known; unknown values are not recorded as zeros
+func (m *MetricsStore) recordStatus(status SystemStatus) {
+    if status.Sources["success_rate"] == SourceUnknown || status.Sources["fitness_score"] == SourceUnknown {
+        return
+    }
+    
+    err := m.Append(time.Now(), MetricsData{
+        SuccessRate: status.SuccessRate,
+        Fitness:     status.FitnessScore,
+        TaskCount:   status.ActiveWorkflows,
+        MemoryMB:    status.MemoryUsageMB,
+    })
+    if err != nil {
+        log.Printf("metrics store: failed to record sample: %v", err)
+    }
+}
+
+// RunStore persists finished jobs as run records in an append-only JSONL
+// file under the data directory, the same way MetricsStore keeps samples
+type RunStore struct {
+    path      string
+    retention time.Duration
+    
+    mu     sync.Mutex
+    read   os.FileInfo // the file offset refers to
+    offset int64
+    runs   []runEntry
+}
+
+type runEntry struct {
+    time time.Time
+    run  JobView
+}
+
+// RunQuery selects run records; zero fields match everything
+type RunQuery struct {
+    Kind   string
+    Name   string
+    Status string
+    From   time.Time
+    To     time.Time
+    Limit  int
+    Offset int
+}
+
+// OpenRunStore loads existing run records from path, creating it if needed.
+// The CLI and the server may share a store: each picks up records the
+// other appends, and only the server compacts. Appends and compaction hold
+// a lock file so a record appended while the server compacts is not lost.
+func OpenRunStore(path string, retention time.Duration) (*RunStore, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return nil, err
+    }
+    
+    store := &RunStore{path: path, retention: retention}
+    store.mu.Lock()
+    defer store.mu.Unlock()
+    if err := store.refresh(); err != nil {
+        return nil, err
+    }
+    return store, nil
+}
+
+// refresh reads records appended to the file since it was last read,
+// whether by this process or another one. Callers hold rs.mu.
+func (rs *RunStore) refresh() error {
+    file, err := os.Open(rs.path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+    if rs.read != nil && !os.SameFile(rs.read, info) {
+        // Another process compacted the file; read the new one from the start
+        rs.offset, rs.runs = 0, nil
+    }
+    rs.read = info
+    
+    if _, err := file.Seek(rs.offset, io.SeekStart); err != nil {
+        return err
+    }
+    reader := bufio.NewReader(file)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if err != nil {
+            // A final line without its newline is still being written;
+            // it is read on a later refresh
+            break
+        }
+        rs.offset += int64(len(line))
+        
+        var run JobView
+        if err := json.Unmarshal(line, &run); err != nil {
+            log.Printf("run store: skipping corrupt record in %s: %v", rs.path, err)
+            continue
+        }
+        t, err := time.Parse(time.RFC3339Nano, run.CreatedAt)
+        if err != nil {
+            continue
+        }
+        
+        // Jobs finish out of order; keep the slice sorted by creation time
+        i := sort.Search(len(rs.runs), func(i int) bool { return rs.runs[i].time.After(t) })
+        rs.runs = append(rs.runs, runEntry{})
+        copy(rs.runs[i+1:], rs.runs[i:])
+        rs.runs[i] = runEntry{time: t, run: run}
+    }
+    return nil
+}
+
+// Append records a finished job
+func (rs *RunStore) Append(run JobView) error {
+    line, err := json.Marshal(run)
+    if err != nil {
+        return err
+    }
+    
+    rs.mu.Lock()
+    defer rs.mu.Unlock()
+    
+    unlock, err := lockFile(rs.path + ".lock")
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
+    // Opened under the lock every time: a file held open across another
+    // process's compaction would be appended to after it was replaced
+    file, err := os.OpenFile(rs.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write(append(line, '\n')); err != nil {
+        file.Close()
+        return err
+    }
+    if err := file.Close(); err != nil {
+        return err
+    }
+    return rs.refresh()
+}
+
+// Compact drops records older than the retention period and atomically
+// rewrites the file with the survivors
+func (rs *RunStore) Compact() error {
+    rs.mu.Lock()
+    defer rs.mu.Unlock()
+    
+    unlock, err := lockFile(rs.path + ".lock")
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
+    if err := rs.refresh(); err != nil {
+        return err
+    }
+    cutoff := time.Now().Add(-rs.retention)
+    keep := sort.Search(len(rs.runs), func(i int) bool {
+        return !rs.runs[i].time.Before(cutoff)
+    })
+    rs.runs = append([]runEntry{}, rs.runs[keep:]...)
+    
+    tmp := rs.path + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    writer := bufio.NewWriter(out)
+    encoder := json.NewEncoder(writer)
+    for _, entry := range rs.runs {
+        if err := encoder.Encode(entry.run); err != nil {
+            out.Close()
+            return err
+        }
+    }
+    if err := writer.Flush(); err != nil {
+        out.Close()
+        return err
+    }
+    info, err := out.Stat()
+    if err != nil {
+        out.Close()
+        return err
+    }
+    if err := out.Close(); err != nil {
+        return err
+    }
+    
+    if err := os.Rename(tmp, rs.path); err != nil {
+        return err
+    }
+    rs.read, rs.offset = info, info.Size()
+    return nil
+}
+
+// staleLockAge is how old a lock file must be before it is taken to be
+// left behind by a process that died holding it
+const staleLockAge = 10 * time.Second
+
+// lockFile takes a lock shared with other processes by creating path
+// exclusively, waiting while another process holds it, and returns the
+// function that releases it. Locks are only held for one append or one
+// compaction, so an old lock file is broken rather than waited on forever.
+func lockFile(path string) (func(), error) {
+    deadline := time.Now().Add(staleLockAge + 5*time.Second)
+    for {
+        file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+        if err == nil {
+            file.Close()
+            return func() { os.Remove(path) }, nil
+        }
+        if !errors.Is(err, os.ErrExist) {
+            return nil, err
+        }
+        if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+            log.Printf("breaking stale lock %s", path)
+            os.Remove(path)
+            continue
+        }
+        if time.Now().After(deadline) {
+            return nil, fmt.Errorf("timed out waiting for lock %s", path)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// Get returns the record for a job ID
+func (rs *RunStore) Get(id string) (JobView, bool) {
+    rs.mu.Lock()
+    defer rs.mu.Unlock()
+    rs.refreshOrLog()
+    for i := len(rs.runs) - 1; i >= 0; i-- {
+        if rs.runs[i].run.ID == id {
+            return rs.runs[i].run, true
+        }
+    }
+    return JobView{}, false
+}
+
+// Query returns one page of matching records, newest first, and the total
+// number of matches
+func (rs *RunStore) Query(q RunQuery) ([]JobView, int) {
+    rs.mu.Lock()
+    defer rs.mu.Unlock()
+    rs.refreshOrLog()
+    
+    page := []JobView{}
+    total := 0
+    for i := len(rs.runs) - 1; i >= 0; i-- {
+        entry := rs.runs[i]
+        switch {
+        case q.Kind != "" && entry.run.Kind != q.Kind,
+            q.Name != "" && entry.run.Name != q.Name,
+            q.Status != "" && entry.run.State != q.Status,
+            !q.From.IsZero() && entry.time.Before(q.From),
+            !q.To.IsZero() && entry.time.After(q.To):
+            continue
+        }
+        if total >= q.Offset && len(page) < q.Limit {
+            page = append(page, entry.run)
+        }
+        total++
+    }
+    return page, total
+}
+
+// Page answers a query with the /api/runs response body
+func (rs *RunStore) Page(q RunQuery) map[string]interface{} {
+    runs, total := rs.Query(q)
+    page := map[string]interface{}{
+        "runs":   runs,
+        "total":  total,
+        "limit":  q.Limit,
+        "offset": q.Offset,
+    }
+    if next := q.Offset + len(runs); next < total {
+        page["next_offset"] = next
+    }
+    return page
+}
+
+// refreshOrLog picks up records other processes appended; a failure only
+// means serving what is already in memory. Callers hold rs.mu.
+func (rs *RunStore) refreshOrLog() {
+    if err := rs.refresh(); err != nil {
+        log.Printf("run store: failed to read %s: %v", rs.path, err)
+    }
+}
+
+// RunCompaction compacts the store now and then every interval until ctx
+// is done
+func (rs *RunStore) RunCompaction(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    
+    for {
+        if err := rs.Compact(); err != nil {
+            log.Printf("run store: compaction failed: %v", err)
+        }
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// record is a JobManager OnFinish hook
+func (rs *RunStore) record(run JobView) {
+    if err := rs.Append(run); err != nil {
+        log.Printf("run store: failed to record %s: %v", run.ID, err)
+    }
+}
+
+// Agent is an agent created through the API. ID is what follow-up calls
+// pass as --agent-id, and so what the module keys the agent's memory cache
+// on: the ID the create function reported, or else the agent's name. Output
+// is what the create function printed.
+type Agent struct {
+    ID        string                 `json:"id"`
+    Name      string                 `json:"name"`
+    Type      string                 `json:"type"`
+    Function  string                 `json:"function"`
+    Options   map[string]interface{} `json:"options,omitempty"`
+    Memory    map[string]string      `json:"memory,omitempty"`
+    Output    string                 `json:"output,omitempty"`
+    CreatedAt string                 `json:"created_at"`
+    UpdatedAt string                 `json:"updated_at,omitempty"`
+}
+
+// AgentStore is the registry of agents, kept as a JSONL file that is
+// rewritten on every change. The module builds agent containers on demand
+// and has no way to list them, so the server is what remembers which exist.
+type AgentStore struct {
+    path     string
+    mu       sync.Mutex
+    agents   []Agent
+    reserved map[string]bool
+}
+
+var (
+    // ErrUnknownAgent is returned for an agent ID that is not registered
+    ErrUnknownAgent = errors.New("unknown agent")
+    // ErrAgentExists is returned by Reserve for a name that is registered
+    // or being created
+    ErrAgentExists = errors.New("agent already exists")
+)
+
+// OpenAgentStore loads the registry from path, creating its directory if
+// needed
+func OpenAgentStore(path string) (*AgentStore, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return nil, err
+    }
+    
+    store := &AgentStore{path: path, agents: []Agent{}, reserved: map[string]bool{}}
+    file, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return store, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+    for scanner.Scan() {
+        var agent Agent
+        if err := json.Unmarshal(scanner.Bytes(), &agent); err != nil {
+            log.Printf("agent store: skipping corrupt record in %s: %v", path, err)
+            continue
+        }
+        store.agents = append(store.agents, agent)
+    }
+    return store, scanner.Err()
+}
+
+// save atomically rewrites the file with agents. Callers hold as.mu and
+// only adopt agents once it succeeded.
+func (as *AgentStore) save(agents []Agent) error {
+    tmp := as.path + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    writer := bufio.NewWriter(out)
+    encoder := json.NewEncoder(writer)
+    for _, agent := range agents {
+        if err := encoder.Encode(agent); err != nil {
+            out.Close()
+            return err
+        }
+    }
+    if err := writer.Flush(); err != nil {
+        out.Close()
+        return err
+    }
+    if err := out.Close(); err != nil {
+        return err
+    }
+    if err := os.Rename(tmp, as.path); err != nil {
+        return err
+    }
+    as.agents = agents
+    return nil
+}
+
+// List returns the agents of a type, or all of them, oldest first
+func (as *AgentStore) List(agentType string) []Agent {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    
+    agents := []Agent{}
+    for _, agent := range as.agents {
+        if agentType == "" || agent.Type == agentType {
+            agents = append(agents, agent)
+        }
+    }
+    return agents
+}
+
+func (as *AgentStore) Get(id string) (Agent, bool) {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    for _, agent := range as.agents {
+        if agent.ID == id {
+            return agent, true
+        }
+    }
+    return Agent{}, false
+}
+
+// Reserve claims name for an agent about to be created, so two requests
+// cannot both create it. The name stays taken until release is called,
+// which the creator does once the agent is added or creating it failed.
+func (as *AgentStore) Reserve(name string) (release func(), err error) {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    
+    if as.reserved[name] {
+        return nil, fmt.Errorf("%w: %q is being created", ErrAgentExists, name)
+    }
+    for _, agent := range as.agents {
+        if agent.Name == name || agent.ID == name {
+            return nil, fmt.Errorf("%w: %q (%s)", ErrAgentExists, name, agent.ID)
+        }
+    }
+    as.reserved[name] = true
+    return sync.OnceFunc(func() {
+        as.mu.Lock()
+        delete(as.reserved, name)
+        as.mu.Unlock()
+    }), nil
+}
+
+// Add registers a new agent, refusing an ID that is already taken
+func (as *AgentStore) Add(agent Agent) error {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    if slices.ContainsFunc(as.agents, func(a Agent) bool { return a.ID == agent.ID }) {
+        return fmt.Errorf("%w: ID %q", ErrAgentExists, agent.ID)
+    }
+    return as.save(append(slices.Clip(as.agents), agent))
+}
+
+// Remember records that key was written to an agent's memory
+func (as *AgentStore) Remember(id, key, value string) (Agent, error) {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    
+    i := slices.IndexFunc(as.agents, func(agent Agent) bool { return agent.ID == id })
+    if i < 0 {
+        return Agent{}, fmt.Errorf("%w %q", ErrUnknownAgent, id)
+    }
+    // Agents handed out earlier share the old memory map, so copy it
+    agent := as.agents[i]
+    memory := make(map[string]string, len(agent.Memory)+1)
+    for k, v := range agent.Memory {
+        memory[k] = v
+    }
+    memory[key] = value
+    agent.Memory = memory
+    agent.UpdatedAt = time.Now().Format(time.RFC3339)
+    
+    agents := slices.Clone(as.agents)
+    agents[i] = agent
+    return agent, as.save(agents)
+}
+
+// Delete removes an agent from the registry and returns it
+func (as *AgentStore) Delete(id string) (Agent, error) {
+    as.mu.Lock()
+    defer as.mu.Unlock()
+    
+    i := slices.IndexFunc(as.agents, func(agent Agent) bool { return agent.ID == id })
+    if i < 0 {
+        return Agent{}, fmt.Errorf("%w %q", ErrUnknownAgent, id)
+    }
+    agent := as.agents[i]
+    return agent, as.save(slices.Delete(slices.Clone(as.agents), i, i+1))
+}
+
+// PromRegistry accumulates the counters and histograms exposed at
+// /metrics in the Prometheus text format
+type PromRegistry struct {
+    mu            sync.Mutex
+    daggerCalls   map[daggerCallKey]uint64
+    daggerLatency map[string]*histogram
+    httpRequests  map[httpRequestKey]uint64
+    httpLatency   map[string]*histogram
+}
+
+type daggerCallKey struct {
+    function string
+    status   string
+}
+
+type httpRequestKey struct {
+    route  string
+    method string
+    code   int
+}
+
+// latencyBuckets covers quick HTTP handlers up to long pipeline runs
+var latencyBuckets = []float64{0.005, 0.025, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+type histogram struct {
+    counts []uint64
+    sum    float64
+    count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+    for i, bound := range latencyBuckets {
+        if v <= bound {
+            h.counts[i]++
+        }
+    }
+    h.sum += v
+    h.count++
+}
+
+func NewPromRegistry() *PromRegistry {
+    return &PromRegistry{
+        daggerCalls:   make(map[daggerCallKey]uint64),
+        daggerLatency: make(map[string]*histogram),
+        httpRequests:  make(map[httpRequestKey]uint64),
+        httpLatency:   make(map[string]*histogram),
+    }
+}
+
+func observe(histograms map[string]*histogram, key string, v float64) {
+    h, ok := histograms[key]
+    if !ok {
+        h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+        histograms[key] = h
+    }
+    h.observe(v)
+}
+
+// ObserveDagger records one Dagger invocation and its outcome
+func (p *PromRegistry) ObserveDagger(function, status string, d time.Duration) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.daggerCalls[daggerCallKey{function, status}]++
+    observe(p.daggerLatency, function, d.Seconds())
+}
+
+// ObserveHTTP records one served request
+func (p *PromRegistry) ObserveHTTP(route, method string, code int, d time.Duration) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.httpRequests[httpRequestKey{route, method, code}]++
+    observe(p.httpLatency, route, d.Seconds())
+}
+
+// Instrument wraps a handler so its requests are counted under route
+func (p *PromRegistry) Instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+        next(recorder, r)
+        p.ObserveHTTP(route, r.Method, recorder.code, time.Since(start))
+    }
+}
+
+// statusRecorder captures the response code while still letting SSE
+// handlers flush
+type statusRecorder struct {
+    http.ResponseWriter
+    code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+    r.code = code
+    r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+    if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
+
+// promWriter emits metric families in the Prometheus text format
+type promWriter struct {
+    b strings.Builder
+}
+
+func (pw *promWriter) family(name, kind, help string) {
+    fmt.Fprintf(&pw.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (pw *promWriter) sample(name string, labels []string, value float64) {
+    pw.b.WriteString(name)
+    if len(labels) > 0 {
+        pw.b.WriteByte('{')
+        for i := 0; i < len(labels); i += 2 {
+            if i > 0 {
+                pw.b.WriteByte(',')
+            }
+            fmt.Fprintf(&pw.b, "%s=\"%s\"", labels[i], promEscaper.Replace(labels[i+1]))
+        }
+        pw.b.WriteByte('}')
+    }
+    pw.b.WriteByte(' ')
+    pw.b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+    pw.b.WriteByte('\n')
+}
+
+func (pw *promWriter) histogram(name string, labels []string, h *histogram) {
+    for i, bound := range latencyBuckets {
+        le := strconv.FormatFloat(bound, 'g', -1, 64)
+        pw.sample(name+"_bucket", append(append([]string{}, labels...), "le", le), float64(h.counts[i]))
+    }
+    pw.sample(name+"_bucket", append(append([]string{}, labels...), "le", "+Inf"), float64(h.count))
+    pw.sample(name+"_sum", labels, h.sum)
+    pw.sample(name+"_count", labels, float64(h.count))
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeStatus exposes the snapshot gauges. Fields with an unknown source
+// are omitted rather than exported as zero.
+func (pw *promWriter) writeStatus(status SystemStatus) {
+    // A simulated snapshot says nothing about Dagger, so it is not connected
+    connected, simulated := 0.0, 0.0
+    switch status.Status {
+    case "CONNECTED":
+        connected = 1
+    case "SIMULATED":
+        simulated = 1
+    }
+    pw.family("proactiva_dagger_connected", "gauge", "Whether the Dagger module answered the last status poll.")
+    pw.sample("proactiva_dagger_connected", nil, connected)
+    pw.family("proactiva_simulated", "gauge", "Whether the server reports simulated data.")
+    pw.sample("proactiva_simulated", nil, simulated)
+    
+    pw.family("proactiva_status_snapshot_age_seconds", "gauge", "Age of the cached status snapshot.")
+    pw.sample("proactiva_status_snapshot_age_seconds", nil, float64(status.SnapshotAgeMS)/1000)
+    
+    gauges := []struct {
+        field, name, help string
+        value             float64
+    }{
+        {"agents", "proactiva_agents", "Number of agents.", float64(status.Agents)},
+        {"generation", "proactiva_generation", "Current evolution generation.", float64(status.Generation)},
+        {"fitness_score", "proactiva_fitness_score", "System fitness score (0-1).", status.FitnessScore},
+        {"success_rate", "proactiva_success_rate", "System-wide success rate (0-1).", status.SuccessRate},
+        {"total_functions", "proactiva_total_functions", "Dagger functions exposed by the module.", float64(status.TotalFunctions)},
+        {"active_workflows", "proactiva_active_workflows", "Workflows currently running.", float64(status.ActiveWorkflows)},
+        {"memory_usage_mb", "proactiva_memory_usage_megabytes", "Memory used by the system in MB.", status.MemoryUsageMB},
+    }
+    for _, g := range gauges {
+        if status.Sources[g.field] == SourceUnknown {
+            continue
+        }
+        pw.family(g.name, "gauge", g.help)
+        pw.sample(g.name, nil, g.value)
+    }
+    
+    if status.Sources["components"] == SourceUnknown {
+        return
+    }
+    names := make([]string, 0, len(status.Components))
+    for name := range status.Components {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    
+    pw.family("proactiva_component_status", "gauge", "Component status; the status label carries the reported state.")
+    for _, name := range names {
+        pw.sample("proactiva_component_status", []string{"component", name, "status", status.Components[name].Status}, 1)
+    }
+    pw.family("proactiva_component_size_megabytes", "gauge", "Component storage size in MB.")
+    for _, name := range names {
+        pw.sample("proactiva_component_size_megabytes", []string{"component", name}, status.Components[name].SizeMB)
+    }
+}
+
+// writeCounters exposes the Dagger and HTTP counters and histograms
+func (p *PromRegistry) writeCounters(pw *promWriter) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    
+    calls := make([]daggerCallKey, 0, len(p.daggerCalls))
+    for key := range p.daggerCalls {
+        calls = append(calls, key)
+    }
+    sort.Slice(calls, func(i, j int) bool {
+        if calls[i].function != calls[j].function {
+            return calls[i].function < calls[j].function
+        }
+        return calls[i].status < calls[j].status
+    })
+    pw.family("proactiva_dagger_invocations_total", "counter", "Dagger invocations by function and outcome.")
+    for _, key := range calls {
+        pw.sample("proactiva_dagger_invocations_total", []string{"function", key.function, "status", key.status}, float64(p.daggerCalls[key]))
+    }
+    
+    pw.family("proactiva_dagger_invocation_duration_seconds", "histogram", "Dagger invocation latency by function.")
+    for _, function := range sortedKeys(p.daggerLatency) {
+        pw.histogram("proactiva_dagger_invocation_duration_seconds", []string{"function", function}, p.daggerLatency[function])
+    }
+    
+    requests := make([]httpRequestKey, 0, len(p.httpRequests))
+    for key := range p.httpRequests {
+        requests = append(requests, key)
+    }
+    sort.Slice(requests, func(i, j int) bool {
+        a, b := requests[i], requests[j]
+        if a.route != b.route {
+            return a.route < b.route
+        }
+        if a.method != b.method {
+            return a.method < b.method
+        }
+        return a.code < b.code
+    })
+    pw.family("proactiva_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+    for _, key := range requests {
+        pw.sample("proactiva_http_requests_total", []string{"route", key.route, "method", key.method, "code", strconv.Itoa(key.code)}, float64(p.httpRequests[key]))
+    }
+    
+    pw.family("proactiva_http_request_duration_seconds", "histogram", "HTTP request latency by route.")
+    for _, route := range sortedKeys(p.httpLatency) {
+        pw.histogram("proactiva_http_request_duration_seconds", []string{"route", route}, p.httpLatency[route])
+    }
+}
+
+func sortedKeys(m map[string]*histogram) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// Tracer records spans for HTTP requests and Dagger invocations and exports
+// them as OTLP/JSON, either to a collector (OTEL_EXPORTER_OTLP_ENDPOINT) or
+// appended to a file (PROACTIVA_TRACE_FILE). A nil *Tracer is a no-op.
+type Tracer struct {
+    service  string
+    endpoint string
+    file     *os.File
+    client   *http.Client
+    spans    chan *Span
+}
+
+// Span kinds and status codes from the OTLP specification
+const (
+    SpanKindInternal = 1
+    SpanKindServer   = 2
+    SpanKindClient   = 3
+    
+    SpanStatusOK    = 1
+    SpanStatusError = 2
+)
+
+// Span is a single timed operation within a trace
+type Span struct {
+    tracer     *Tracer
+    traceID    [16]byte
+    spanID     [8]byte
+    parentID   [8]byte
+    name       string
+    kind       int
+    start      time.Time
+    end        time.Time
+    attributes map[string]interface{}
+    statusCode int
+    statusMsg  string
+}
+
+type spanContextKey struct{}
+
+// NewTracer returns nil when neither an endpoint nor a file is configured
+func NewTracer(service, endpoint, filePath string) (*Tracer, error) {
+    if endpoint == "" && filePath == "" {
+        return nil, nil
+    }
+    
+    t := &Tracer{
+        service:  service,
+        endpoint: strings.TrimRight(endpoint, "/"),
+        client:   &http.Client{Timeout: 10 * time.Second},
+        spans:    make(chan *Span, 1024),
+    }
+    if filePath != "" {
+        file, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+        if err != nil {
+            return nil, fmt.Errorf("failed to open trace file: %w", err)
+        }
+        t.file = file
+    }
+    go t.exportLoop()
+    return t, nil
+}
+
+// Start begins a span as a child of the span in ctx, or of the remote
+// parent carried by traceparent when ctx has none
+func (t *Tracer) Start(ctx context.Context, name string, kind int, traceparent string) (context.Context, *Span) {
+    if t == nil {
+        return ctx, nil
+    }
+    
+    span := &Span{
+        tracer:     t,
+        name:       name,
+        kind:       kind,
+        start:      time.Now(),
+        attributes: make(map[string]interface{}),
+    }
+    if parent := SpanFromContext(ctx); parent != nil {
+        span.traceID = parent.traceID
+        span.parentID = parent.spanID
+    } else if traceID, parentID, ok := parseTraceparent(traceparent); ok {
+        span.traceID = traceID
+        span.parentID = parentID
+    } else {
+        cryptorand.Read(span.traceID[:])
+    }
+    cryptorand.Read(span.spanID[:])
+    
+    return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SpanFromContext returns the active span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+    span, _ := ctx.Value(spanContextKey{}).(*Span)
+    return span
+}
+
+// parseTraceparent decodes a W3C traceparent header
+func parseTraceparent(value string) (traceID [16]byte, spanID [8]byte, ok bool) {
+    parts := strings.Split(value, "-")
+    if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+        return traceID, spanID, false
+    }
+    if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+        return traceID, spanID, false
+    }
+    if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+        return traceID, spanID, false
+    }
+    return traceID, spanID, traceID != [16]byte{} && spanID != [8]byte{}
+}
+
+// Traceparent formats the span as a W3C traceparent value
+func (span *Span) Traceparent() string {
+    if span == nil {
+        return ""
+    }
+    return fmt.Sprintf("00-%x-%x-01", span.traceID, span.spanID)
+}
+
+// SetAttribute attaches a string, bool, int, float64 or []string value
+func (span *Span) SetAttribute(key string, value interface{}) {
+    if span != nil {
+        span.attributes[key] = value
+    }
+}
+
+// SetError marks the span failed with err's message
+func (span *Span) SetError(err error) {
+    if span != nil && err != nil {
+        span.statusCode = SpanStatusError
+        span.statusMsg = err.Error()
+    }
+}
+
+// End finishes the span and queues it for export
+func (span *Span) End() {
+    if span == nil {
+        return
+    }
+    span.end = time.Now()
+    if span.statusCode == 0 {
+        span.statusCode = SpanStatusOK
+    }
+    select {
+    case span.tracer.spans <- span:
+    default:
+        // Never block a request on a slow collector
+    }
+}
+
+// exportLoop batches finished spans and flushes them every few seconds
+func (t *Tracer) exportLoop() {
+    ticker := time.NewTicker(2 * time.Second)
+    defer ticker.Stop()
+    
+    var batch []*Span
+    for {
+        select {
+        case span := <-t.spans:
+            batch = append(batch, span)
+            if len(batch) < 256 {
+                continue
+            }
+        case <-ticker.C:
+            if len(batch) == 0 {
+                continue
+            }
+        }
+        if err := t.export(batch); err != nil {
+            log.Printf("tracing: export failed: %v", err)
+        }
+        batch = nil
+    }
+}
+
+func (t *Tracer) export(batch []*Span) error {
+    spans := make([]map[string]interface{}, 0, len(batch))
+    for _, span := range batch {
+        spans = append(spans, span.otlp())
+    }
+    payload, err := json.Marshal(map[string]interface{}{
+        "resourceSpans": []interface{}{map[string]interface{}{
+            "resource": map[string]interface{}{
+                "attributes": otlpAttributes(map[string]interface{}{"service.name": t.service}),
+            },
+            "scopeSpans": []interface{}{map[string]interface{}{
+                "scope": map[string]string{"name": "proactiva-web-server"},
+                "spans": spans,
+            }},
+        }},
+    })
+    if err != nil {
+        return err
+    }
+    
+    if t.file != nil {
+        if _, err := t.file.Write(append(payload, '\n')); err != nil {
+            return err
+        }
+    }
+    if t.endpoint != "" {
+        resp, err := t.client.Post(t.endpoint+"/v1/traces", "application/json", bytes.NewReader(payload))
+        if err != nil {
+            return err
+        }
+        resp.Body.Close()
+        if resp.StatusCode >= 300 {
+            return fmt.Errorf("collector returned %s", resp.Status)
+        }
+    }
+    return nil
+}
+
+func (span *Span) otlp() map[string]interface{} {
+    out := map[string]interface{}{
+        "traceId":           hex.EncodeToString(span.traceID[:]),
+        "spanId":            hex.EncodeToString(span.spanID[:]),
+        "name":              span.name,
+        "kind":              span.kind,
+        "startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+        "endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+        "attributes":        otlpAttributes(span.attributes),
+        "status":            map[string]interface{}{"code": span.statusCode, "message": span.statusMsg},
+    }
+    if span.parentID != [8]byte{} {
+        out["parentSpanId"] = hex.EncodeToString(span.parentID[:])
+    }
+    return out
+}
+
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+    keys := make([]string, 0, len(attributes))
+    for key := range attributes {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    
+    out := make([]map[string]interface{}, 0, len(keys))
+    for _, key := range keys {
+        out = append(out, map[string]interface{}{"key": key, "value": otlpValue(attributes[key])})
+    }
+    return out
+}
+
+func otlpValue(value interface{}) map[string]interface{} {
+    switch v := value.(type) {
+    case bool:
+        return map[string]interface{}{"boolValue": v}
+    case int:
+        return map[string]interface{}{"intValue": strconv.Itoa(v)}
+    case int64:
+        return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+    case float64:
+        return map[string]interface{}{"doubleValue": v}
+    case []string:
+        values := make([]map[string]interface{}, 0, len(v))
+        for _, item := range v {
+            values = append(values, otlpValue(item))
+        }
+        return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+    default:
+        return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+    }
+}
+
+// Trace wraps a handler in a server span named after its route, joining
+// the caller's trace when a traceparent header is present
+func (t *Tracer) Trace(route string, next http.HandlerFunc) http.HandlerFunc {
+    if t == nil {
+        return next
+    }
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx, span := t.Start(r.Context(), r.Method+" "+route, SpanKindServer, r.Header.Get("traceparent"))
+        span.SetAttribute("http.request.method", r.Method)
+        span.SetAttribute("http.route", route)
+        span.SetAttribute("url.path", r.URL.Path)
+        
+        recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+        next(recorder, r.WithContext(ctx))
+        
+        span.SetAttribute("http.response.status_code", recorder.code)
+        if recorder.code >= 500 {
+            span.SetError(fmt.Errorf("HTTP %d", recorder.code))
+        }
+        span.End()
+    }
+}
+
+// Event types published on the EventBus
+const (
+    EventSystemConnected    = "system_connected"
+    EventStatusUpdate       = "status_update"
+    EventConnectionLost     = "connection_lost"
+    EventConnectionRestored = "connection_restored"
+    EventTestStarted        = "test_started"
+    EventTestFinished       = "test_finished"
+    EventCommandExecuted    = "command_executed"
+    EventAgentCreated       = "agent_created"
+    EventAgentDeleted       = "agent_deleted"
+    EventEvolutionTriggered = "evolution_triggered"
+    EventA2AMessage         = "a2a_message"
+    EventJobQueued          = "job_queued"
+    EventJobStarted         = "job_started"
+    EventJobFinished        = "job_finished"
+)
+
+// eventTopics maps each event type to the topic clients subscribe to
+var eventTopics = map[string]string{
+    EventSystemConnected:    "status",
+    EventStatusUpdate:       "status",
+    EventConnectionLost:     "status",
+    EventConnectionRestored: "status",
+    EventTestStarted:        "tests",
+    EventTestFinished:       "tests",
+    EventCommandExecuted:    "commands",
+    EventAgentCreated:       "agents",
+    EventAgentDeleted:       "agents",
+    EventEvolutionTriggered: "evolution",
+    EventA2AMessage:         "a2a",
+    EventJobQueued:          "jobs",
+    EventJobStarted:         "jobs",
+    EventJobFinished:        "jobs",
+}
+
+// EventFilter selects the events a subscriber receives. Nil Topics means
+// every topic. When Agent is set, events that name agents (an "agent" or
+// "agents" field) are only delivered if they name that agent; events about
+// no particular agent are unaffected.
+type EventFilter struct {
+    Topics map[string]bool
+    Agent  string
+}
+
+// ParseEventFilter reads ?topics=a,b&agent=name, rejecting unknown topics
+func ParseEventFilter(query url.Values) (EventFilter, error) {
+    filter := EventFilter{Agent: query.Get("agent")}
+    
+    if v := query.Get("topics"); v != "" {
+        known := make(map[string]bool)
+        for _, topic := range eventTopics {
+            known[topic] = true
+        }
+        filter.Topics = make(map[string]bool)
+        for _, topic := range strings.Split(v, ",") {
+            topic = strings.TrimSpace(topic)
+            if !known[topic] {
+                return filter, fmt.Errorf("unknown topic %q", topic)
+            }
+            filter.Topics[topic] = true
+        }
+    }
+    return filter, nil
+}
+
+// Match reports whether evt passes the filter. Events without a topic
+// (such as replay_truncated) always pass.
+func (f EventFilter) Match(evt Event) bool {
+    if topic, ok := eventTopics[evt.Type]; ok && f.Topics != nil && !f.Topics[topic] {
+        return false
+    }
+    if f.Agent == "" {
+        return true
+    }
+    
+    named := false
+    if agent, ok := evt.Fields["agent"].(string); ok {
+        named = true
+        if agent == f.Agent {
+            return true
+        }
+    }
+    // Events restored from the event log decode lists as []interface{}
+    switch agents := evt.Fields["agents"].(type) {
+    case []string:
+        named = true
+        for _, agent := range agents {
+            if agent == f.Agent {
+                return true
+            }
+        }
+    case []interface{}:
+        named = true
+        for _, agent := range agents {
+            if agent == f.Agent {
+                return true
+            }
+        }
+    }
+    return !named
+}
+
+// Event is a typed message published on the EventBus. Fields are
+// flattened next to "event" and "timestamp" when encoded, which is the
+// shape SSE clients have always received.
+type Event struct {
+    ID        uint64
+    Type      string
+    Timestamp time.Time
+    Fields    map[string]interface{}
+}
+
+func NewEvent(eventType string, fields map[string]interface{}) Event {
+    return Event{Type: eventType, Timestamp: time.Now(), Fields: fields}
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+    out := e.data()
+    out["event"] = e.Type
+    if e.ID != 0 {
+        out["id"] = e.ID
+    }
+    return json.Marshal(out)
+}
+
+// data is the event payload without its type, which SSE carries in the
+// "event:" field instead
+func (e Event) data() map[string]interface{} {
+    out := make(map[string]interface{}, len(e.Fields)+1)
+    for key, value := range e.Fields {
+        out[key] = value
+    }
+    out["timestamp"] = e.Timestamp.Format(time.RFC3339)
+    return out
+}
+
+// storedEvent is the on-disk form of an Event in the replay log
+type storedEvent struct {
+    ID        uint64                 `json:"id"`
+    Type      string                 `json:"type"`
+    Timestamp time.Time              `json:"timestamp"`
+    Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// EventBus fans published events out to every subscriber. Each subscriber
+// has its own buffer; one that falls a full buffer behind is dropped (its
+// channel is closed) so a slow client can never stall publishers.
+//
+// Every event gets a monotonically increasing ID and the most recent ones
+// are kept in a bounded replay ring, optionally mirrored to an append-only
+// log so IDs and history survive restarts.
+type EventBus struct {
+    buffer   int
+    capacity int
+    
+    mu          sync.Mutex
+    subscribers map[*Subscription]struct{}
+    nextID      uint64
+    ring        []Event
+    log         *os.File
+    logLines    int
+    logPath     string
+}
+
+// Subscription receives events on C until it is unsubscribed or dropped
+type Subscription struct {
+    C      <-chan Event
+    ch     chan Event
+    filter EventFilter
+}
+
+func NewEventBus(buffer, capacity int) *EventBus {
+    return &EventBus{
+        buffer:      buffer,
+        capacity:    capacity,
+        subscribers: make(map[*Subscription]struct{}),
+        nextID:      1,
+    }
+}
+
+// OpenEventLog restores the replay ring from path and appends every
+// subsequent event to it
+func (b *EventBus) OpenEventLog(path string) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+    
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    
+    if file, err := os.Open(path); err == nil {
+        scanner := bufio.NewScanner(file)
+        scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+        for scanner.Scan() {
+            var stored storedEvent
+            if json.Unmarshal(scanner.Bytes(), &stored) != nil {
+                continue
+            }
+            b.remember(Event{ID: stored.ID, Type: stored.Type, Timestamp: stored.Timestamp, Fields: stored.Fields})
+            if stored.ID >= b.nextID {
+                b.nextID = stored.ID + 1
+            }
+        }
+        file.Close()
+    } else if !errors.Is(err, os.ErrNotExist) {
+        return err
+    }
+    
+    b.logPath = path
+    return b.rewriteLog()
+}
+
+// rewriteLog replaces the log with the current ring so it stays bounded.
+// Callers hold b.mu.
+func (b *EventBus) rewriteLog() error {
+    if b.log != nil {
+        b.log.Close()
+    }
+    tmp := b.logPath + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    encoder := json.NewEncoder(out)
+    for _, evt := range b.ring {
+        encoder.Encode(storedEvent{ID: evt.ID, Type: evt.Type, Timestamp: evt.Timestamp, Fields: evt.Fields})
+    }
+    out.Close()
+    if err := os.Rename(tmp, b.logPath); err != nil {
+        return err
+    }
+    
+    b.log, err = os.OpenFile(b.logPath, os.O_APPEND|os.O_WRONLY, 0o644)
+    b.logLines = len(b.ring)
+    return err
+}
+
+// remember appends evt to the replay ring. Callers hold b.mu.
+func (b *EventBus) remember(evt Event) {
+    b.ring = append(b.ring, evt)
+    if len(b.ring) > b.capacity {
+        b.ring = append([]Event{}, b.ring[len(b.ring)-b.capacity:]...)
+    }
+}
+
+func (b *EventBus) Subscribe(filter EventFilter) *Subscription {
+    sub, _, _ := b.SubscribeFrom(0, filter)
+    return sub
+}
+
+// SubscribeFrom registers a subscriber and atomically returns the retained
+// events matching filter with an ID after lastID, so nothing falls between
+// replay and live delivery. truncated reports that some events after lastID
+// have already left the ring. A lastID of 0 replays nothing.
+func (b *EventBus) SubscribeFrom(lastID uint64, filter EventFilter) (sub *Subscription, replay []Event, truncated bool) {
+    ch := make(chan Event, b.buffer)
+    sub = &Subscription{C: ch, ch: ch, filter: filter}
+    
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.subscribers[sub] = struct{}{}
+    
+    if lastID == 0 {
+        return sub, nil, false
+    }
+    
+    // lastID >= nextID means the client saw IDs from before a restart
+    // without an event log; everything retained is new to it
+    restarted := lastID >= b.nextID
+    for _, evt := range b.ring {
+        if (restarted || evt.ID > lastID) && filter.Match(evt) {
+            replay = append(replay, evt)
+        }
+    }
+    truncated = restarted || len(b.ring) == 0 || b.ring[0].ID > lastID+1
+    return sub, replay, truncated
+}
+
+// Unsubscribe removes sub; it is safe to call after sub was dropped
+func (b *EventBus) Unsubscribe(sub *Subscription) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if _, ok := b.subscribers[sub]; ok {
+        delete(b.subscribers, sub)
+        close(sub.ch)
+    }
+}
+
+// Publish assigns evt the next ID, retains it for replay and delivers it to
+// every subscriber without blocking
+func (b *EventBus) Publish(evt Event) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    
+    evt.ID = b.nextID
+    b.nextID++
+    b.remember(evt)
+    
+    if b.log != nil {
+        line, err := json.Marshal(storedEvent{ID: evt.ID, Type: evt.Type, Timestamp: evt.Timestamp, Fields: evt.Fields})
+        if err == nil {
+            b.log.Write(append(line, '\n'))
+            b.logLines++
+        }
+        if b.logLines > 2*b.capacity {
+            if err := b.rewriteLog(); err != nil {
+                log.Printf("events: failed to compact event log: %v", err)
+            }
+        }
+    }
+    
+    for sub := range b.subscribers {
+        if !sub.filter.Match(evt) {
+            continue
+        }
+        select {
+        case sub.ch <- evt:
+        default:
+            log.Printf("events: dropping slow subscriber after %d buffered events", b.buffer)
+            delete(b.subscribers, sub)
+            close(sub.ch)
+        }
+    }
+}
+
+// publishStatus is the status poller's hook: a snapshot that differs from
+// the last one becomes a status_update, and connectivity changes are
+// announced explicitly. Unchanged snapshots are not published, so polling
+// does not push the events clients replay out of the ring.
+func (s *Server) publishStatus(status SystemStatus) {
+    connected := status.Connected
+    update := statusEvent(EventStatusUpdate, status)
+    fields, _ := json.Marshal(update.Fields)
+    
+    s.eventsMu.Lock()
+    changed := s.lastConnected != nil && *s.lastConnected != connected
+    s.lastConnected = &connected
+    unchanged := bytes.Equal(fields, s.lastStatus)
+    s.lastStatus = fields
+    s.eventsMu.Unlock()
+    
+    if changed && !connected {
+        s.events.Publish(NewEvent(EventConnectionLost, map[string]interface{}{
+            "error": status.Error,
+        }))
+    } else if changed {
+        s.events.Publish(NewEvent(EventConnectionRestored, nil))
+    }
+    
+    if !unchanged {
+        s.events.Publish(update)
+    }
+}
+
+func statusEvent(eventType string, status SystemStatus) Event {
+    return NewEvent(eventType, map[string]interface{}{
+        "success_rate": status.SuccessRate,
+        "memory_mb":    status.MemoryUsageMB,
+        "agents":       status.Agents,
+        "status":       status.Status,
+        "connected":    status.Connected,
+        "sources":      status.Sources,
+    })
+}
+
+// publishInvocation announces Dagger calls that change system state
+func (s *Server) publishInvocation(function string, args []string, err error) {
+    if err != nil {
+        return
+    }
+    switch {
+    case function == "create-agent" || (strings.HasPrefix(function, "create-") && strings.HasSuffix(function, "-agent")):
+        fields := map[string]interface{}{
+            "function": function,
+            "args":     args,
+        }
+        if agent := flagValue(args, "--name"); agent != "" {
+            fields["agent"] = agent
+        }
+        s.events.Publish(NewEvent(EventAgentCreated, fields))
+    case function == "trigger-evolution":
+        s.events.Publish(NewEvent(EventEvolutionTriggered, map[string]interface{}{
+            "args": args,
+        }))
+    case strings.Contains(function, "a-2-a"):
+        fields := map[string]interface{}{
+            "function": function,
+            "args":     args,
+        }
+        var agents []string
+        for _, flag := range []string{"--from-agent", "--to-agent"} {
+            if agent := flagValue(args, flag); agent != "" {
+                agents = append(agents, agent)
+            }
+        }
+        if len(agents) > 0 {
+            fields["agents"] = agents
+        }
+        s.events.Publish(NewEvent(EventA2AMessage, fields))
+    }
+}
+
+// flagValue returns the value of flag in a dagger argument list, given
+// either as "--flag value" or "--flag=value"
+func flagValue(args []string, flag string) string {
+    for i, arg := range args {
+        if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+            return value
+        }
+        if arg == flag && i+1 < len(args) {
+            return args[i+1]
+        }
+    }
+    return ""
+}
+
+// Job states
+const (
+    JobQueued    = "queued"
+    JobRunning   = "running"
+    JobSucceeded = "succeeded"
+    JobFailed    = "failed"
+    JobCancelled = "cancelled"
+    JobTimedOut  = "timed_out"
+)
+
+// JobSpec describes what a job runs and who asked for it
+type JobSpec struct {
+    Kind      string
+    Name      string
+    Args      map[string]interface{}
+    Initiator string
+    Priority  string
+}
+
+// Job is an asynchronous test run or command started through the API
+type Job struct {
+    ID string
+    JobSpec
+    
+    mu          sync.Mutex
+    state       string
+    createdAt   time.Time
+    startedAt   time.Time
+    finishedAt  time.Time
+    result      map[string]interface{}
+    invocations []JobInvocation
+    logs        []LogLine
+    logCount    int
+    logNotify   chan struct{}
+    position    int
+    run         func()
+    cancel      context.CancelFunc
+    done        chan struct{}
+    
+    // slot marks a worker taken by Acquire: it queues and runs like a job
+    // but is not listed, announced or recorded
+    slot bool
+}
+
+// maxJobLogLines bounds the log kept per job; older lines are dropped first.
+// The slice may grow jobLogSlack lines past it so trimming, which copies
+// the survivors, happens once per chunk rather than on every line.
+const (
+    maxJobLogLines = 20000
+    jobLogSlack    = maxJobLogLines / 4
+)
+
+// LogLine is one line of a Dagger invocation's stdout or stderr
+type LogLine struct {
+    Seq      int    `json:"seq"`
+    Time     string `json:"time"`
+    Function string `json:"function"`
+    Stream   string `json:"stream"`
+    Line     string `json:"line"`
+}
+
+// JobInvocation is one Dagger call made while a job ran
+type JobInvocation struct {
+    Function   string   `json:"function"`
+    Args       []string `json:"args"`
+    Status     string   `json:"status"`
+    ExitCode   int      `json:"exit_code"`
+    DurationMS int64    `json:"duration_ms"`
+    Output     string   `json:"output"`
+}
+
+// JobView is the JSON representation of a Job
+type JobView struct {
+    ID          string                 `json:"id"`
+    Kind        string                 `json:"kind"`
+    Name        string                 `json:"name"`
+    Args        map[string]interface{} `json:"args,omitempty"`
+    Initiator   string                 `json:"initiator,omitempty"`
+    Priority    string                 `json:"priority"`
+    State       string                 `json:"state"`
+    Position    int                    `json:"queue_position,omitempty"`
+    CreatedAt   string                 `json:"created_at"`
+    StartedAt   string                 `json:"started_at,omitempty"`
+    FinishedAt  string                 `json:"finished_at,omitempty"`
+    DurationMS  int64                  `json:"duration_ms"`
+    ExitCode    *int                   `json:"exit_code,omitempty"`
+    Output      string                 `json:"output"`
+    LogLines    int                    `json:"log_lines"`
+    Result      map[string]interface{} `json:"result,omitempty"`
+    Invocations []JobInvocation        `json:"invocations"`
+}
+
+type jobContextKey struct{}
+
+func jobFromContext(ctx context.Context) *Job {
+    job, _ := ctx.Value(jobContextKey{}).(*Job)
+    return job
+}
+
+// Done is closed when the job has finished
+func (j *Job) Done() <-chan struct{} {
+    return j.done
+}
+
+// appendLog records a line and wakes anyone following the log
+func (j *Job) appendLog(function, stream, line string) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    
+    j.logCount++
+    j.logs = append(j.logs, LogLine{
+        Seq:      j.logCount,
+        Time:     time.Now().Format(time.RFC3339Nano),
+        Function: function,
+        Stream:   stream,
+        Line:     line,
+    })
+    if len(j.logs) > maxJobLogLines+jobLogSlack {
+        j.logs = append(make([]LogLine, 0, maxJobLogLines+jobLogSlack+1), j.logs[len(j.logs)-maxJobLogLines:]...)
+    }
+    j.notifyLocked()
+}
+
+// notifyLocked wakes anyone following the job. Callers hold j.mu.
+func (j *Job) notifyLocked() {
+    close(j.logNotify)
+    j.logNotify = make(chan struct{})
+}
+
+// LogsAfter returns the retained lines with Seq > seq, a channel closed
+// when more arrive or the job's state or queue position changes, and whether the job had already finished, in which case
+// the lines are complete
+func (j *Job) LogsAfter(seq int) ([]LogLine, <-chan struct{}, bool) {
+    // Check done first: once it is closed no more lines can be appended
+    finished := false
+    select {
+    case <-j.done:
+        finished = true
+    default:
+    }
+    
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    // Lines in the slack are already past the limit
+    logs := j.logs[max(0, len(j.logs)-maxJobLogLines):]
+    i := sort.Search(len(logs), func(i int) bool { return logs[i].Seq > seq })
+    return append([]LogLine{}, logs[i:]...), j.logNotify, finished
+}
+
+func (j *Job) recordInvocation(inv JobInvocation) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    j.invocations = append(j.invocations, inv)
+}
+
+// View snapshots the job. Output joins every invocation's output and the
+// exit code is that of the last invocation.
+func (j *Job) View() JobView {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    
+    view := JobView{
+        ID:          j.ID,
+        Kind:        j.Kind,
+        Name:        j.Name,
+        Args:        j.Args,
+        Initiator:   j.Initiator,
+        Priority:    j.Priority,
+        State:       j.state,
+        Position:    j.position,
+        CreatedAt:   j.createdAt.Format(time.RFC3339Nano),
+        Result:      j.result,
+        LogLines:    j.logCount,
+        Invocations: append([]JobInvocation{}, j.invocations...),
+    }
+    if !j.startedAt.IsZero() {
+        view.StartedAt = j.startedAt.Format(time.RFC3339Nano)
+        end := j.finishedAt
+        if end.IsZero() {
+            end = time.Now()
+        }
+        view.DurationMS = end.Sub(j.startedAt).Milliseconds()
+    }
+    if !j.finishedAt.IsZero() {
+        view.FinishedAt = j.finishedAt.Format(time.RFC3339Nano)
+    }
+    
+    var output []string
+    for _, inv := range j.invocations {
+        if text := strings.TrimSpace(inv.Output); text != "" {
+            output = append(output, text)
+        }
+    }
+    view.Output = strings.Join(output, "\n")
+    if n := len(j.invocations); n > 0 {
+        code := j.invocations[n-1].ExitCode
+        view.ExitCode = &code
+    }
+    return view
+}
+
+// jobState derives the final state from a test or command result
+func jobState(result map[string]interface{}) string {
+    switch status, _ := result["status"].(string); status {
+    case InvocationCancelled:
+        return JobCancelled
+    case InvocationTimedOut:
+        return JobTimedOut
+    }
+    if success, ok := result["success"].(bool); ok {
+        if success {
+            return JobSucceeded
+        }
+        return JobFailed
+    }
+    if result["status"] == InvocationOK {
+        return JobSucceeded
+    }
+    return JobFailed
+}
+
+// Job priority classes. Queued interactive jobs always start before
+// background ones; each class is FIFO.
+const (
+    PriorityInteractive = "interactive"
+    PriorityBackground  = "background"
+)
+
+// ErrQueueFull is returned by JobManager.Start when every worker is busy
+// and the queue is at capacity
+var ErrQueueFull = errors.New("job queue is full")
+
+// JobManager runs jobs on a bounded pool of workers, queueing the rest,
+// and keeps the most recent ones for inspection
+type JobManager struct {
+    events     *EventBus
+    limit      int
+    workers    int
+    queueLimit int
+    
+    mu        sync.Mutex
+    jobs      map[string]*Job
+    order     []string
+    listeners []func(JobView)
+    running   int
+    queue     map[string][]*Job
+}
+
+func NewJobManager(events *EventBus, limit, workers, queueLimit int) *JobManager {
+    return &JobManager{
+        events:     events,
+        limit:      limit,
+        workers:    workers,
+        queueLimit: queueLimit,
+        jobs:       make(map[string]*Job),
+        queue:      make(map[string][]*Job),
+    }
+}
+
+// OnFinish registers fn to be called with every job once it has finished
+func (m *JobManager) OnFinish(fn func(JobView)) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.listeners = append(m.listeners, fn)
+}
+
+// Start runs fn as a new job, or queues it when every worker is busy. The
+// job keeps the parent's values (such as the trace span) but not its
+// cancellation, so it outlives the request.
+func (m *JobManager) Start(parent context.Context, spec JobSpec, fn func(ctx context.Context) map[string]interface{}) (*Job, error) {
+    if spec.Priority == "" {
+        spec.Priority = PriorityInteractive
+    }
+    
+    var raw [6]byte
+    cryptorand.Read(raw[:])
+    
+    ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+    job := &Job{
+        ID:        "job-" + hex.EncodeToString(raw[:]),
+        JobSpec:   spec,
+        createdAt: time.Now(),
+        cancel:    cancel,
+        done:      make(chan struct{}),
+        logNotify: make(chan struct{}),
+    }
+    ctx = context.WithValue(ctx, jobContextKey{}, job)
+    job.run = func() {
+        defer cancel()
+        m.finish(job, fn(ctx))
+        
+        m.mu.Lock()
+        m.running--
+        m.dispatch()
+        m.mu.Unlock()
+    }
+    
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    
+    queued := len(m.queue[PriorityInteractive]) + len(m.queue[PriorityBackground])
+    if m.running >= m.workers && queued >= m.queueLimit {
+        cancel()
+        return nil, ErrQueueFull
+    }
+    
+    m.jobs[job.ID] = job
+    m.order = append(m.order, job.ID)
+    m.evict()
+    
+    job.state = JobQueued
+    m.queue[spec.Priority] = append(m.queue[spec.Priority], job)
+    m.dispatch()
+    
+    // A job dispatch started may already be finishing on its worker
+    job.mu.Lock()
+    waiting, position := job.state == JobQueued, job.position
+    job.mu.Unlock()
+    if waiting {
+        m.events.Publish(NewEvent(EventJobQueued, map[string]interface{}{
+            "job_id":         job.ID,
+            "kind":           spec.Kind,
+            "name":           spec.Name,
+            "priority":       spec.Priority,
+            "queue_position": position,
+        }))
+    }
+    return job, nil
+}
+
+// dispatch starts queued jobs while workers are free and renumbers the
+// rest. Callers hold m.mu.
+func (m *JobManager) dispatch() {
+    position := 0
+    for _, priority := range []string{PriorityInteractive, PriorityBackground} {
+        queue := m.queue[priority]
+        for len(queue) > 0 && m.running < m.workers {
+            job := queue[0]
+            queue = queue[1:]
+            m.running++
+            
+            job.mu.Lock()
+            job.state = JobRunning
+            job.startedAt = time.Now()
+            job.position = 0
+            if !job.slot {
+                job.notifyLocked()
+            }
+            job.mu.Unlock()
+            
+            if !job.slot {
+                m.events.Publish(NewEvent(EventJobStarted, map[string]interface{}{
+                    "job_id": job.ID,
+                    "kind":   job.Kind,
+                    "name":   job.Name,
+                }))
+            }
+            go job.run()
+        }
+        m.queue[priority] = queue
+        
+        for _, job := range queue {
+            position++
+            job.mu.Lock()
+            if job.position != position && !job.slot {
+                job.position = position
+                job.notifyLocked()
+            }
+            job.mu.Unlock()
+        }
+    }
+}
+
+// Acquire takes a worker for Dagger work done within a request rather than
+// as a job of its own, such as introspecting a function, so it counts
+// against the same limit. It waits its turn with interactive jobs, fails
+// with ErrQueueFull like Start, and gives up when ctx is done. The worker
+// is held until release is called.
+func (m *JobManager) Acquire(ctx context.Context) (release func(), err error) {
+    granted := make(chan struct{})
+    released := make(chan struct{})
+    slot := &Job{JobSpec: JobSpec{Priority: PriorityInteractive}, slot: true}
+    slot.run = func() {
+        close(granted)
+        <-released
+        
+        m.mu.Lock()
+        m.running--
+        m.dispatch()
+        m.mu.Unlock()
+    }
+    release = sync.OnceFunc(func() { close(released) })
+    
+    m.mu.Lock()
+    queued := len(m.queue[PriorityInteractive]) + len(m.queue[PriorityBackground])
+    if m.running >= m.workers && queued >= m.queueLimit {
+        m.mu.Unlock()
+        return nil, ErrQueueFull
+    }
+    m.queue[PriorityInteractive] = append(m.queue[PriorityInteractive], slot)
+    m.dispatch()
+    m.mu.Unlock()
+    
+    select {
+    case <-granted:
+        return release, nil
+    case <-ctx.Done():
+    }
+    
+    m.mu.Lock()
+    queue := m.queue[PriorityInteractive]
+    i := slices.Index(queue, slot)
+    if i >= 0 {
+        m.queue[PriorityInteractive] = append(queue[:i:i], queue[i+1:]...)
+        m.dispatch()
+    }
+    m.mu.Unlock()
+    if i < 0 {
+        // Started just as ctx ended; hand the worker straight back
+        release()
+    }
+    return nil, ctx.Err()
+}
+
+// finish records the job's result and notifies listeners and subscribers
+func (m *JobManager) finish(job *Job, result map[string]interface{}) {
+    job.mu.Lock()
+    job.result = result
+    job.state = jobState(result)
+    job.position = 0
+    job.finishedAt = time.Now()
+    job.mu.Unlock()
+
+    // Listeners run before done is closed so that anyone waiting on the job
+    // (the CLI in particular) sees its run record already persisted.
+    view := job.View()
+    m.mu.Lock()
+    listeners := append([]func(JobView){}, m.listeners...)
+    m.mu.Unlock()
+    for _, fn := range listeners {
+        fn(view)
+    }
+    close(job.done)
+
+    m.events.Publish(NewEvent(EventJobFinished, map[string]interface{}{
+        "job_id":      job.ID,
+        "kind":        job.Kind,
+        "name":        job.Name,
+        "state":       view.State,
+        "duration_ms": view.DurationMS,
+    }))
+}
+
+// evict forgets the oldest finished jobs beyond the limit. Callers hold m.mu.
+func (m *JobManager) evict() {
+    for i := 0; len(m.order) > m.limit && i < len(m.order); {
+        job := m.jobs[m.order[i]]
+        select {
+        case <-job.done:
+            delete(m.jobs, job.ID)
+            m.order = append(m.order[:i], m.order[i+1:]...)
+        default:
+            i++
+        }
+    }
+}
+
+func (m *JobManager) Get(id string) *Job {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.jobs[id]
+}
+
+// List returns jobs newest first, optionally restricted to a state and kind
+func (m *JobManager) List(state, kind string) []JobView {
+    m.mu.Lock()
+    jobs := make([]*Job, 0, len(m.order))
+    for i := len(m.order) - 1; i >= 0; i-- {
+        jobs = append(jobs, m.jobs[m.order[i]])
+    }
+    m.mu.Unlock()
+    
+    views := []JobView{}
+    for _, job := range jobs {
+        view := job.View()
+        if (state == "" || view.State == state) && (kind == "" || view.Kind == kind) {
+            views = append(views, view)
+        }
+    }
+    return views
+}
+
+// Stats reports how many jobs are running and queued per priority
+func (m *JobManager) Stats() (running int, queued map[string]int) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    queued = map[string]int{
+        PriorityInteractive: len(m.queue[PriorityInteractive]),
+        PriorityBackground:  len(m.queue[PriorityBackground]),
+    }
+    return m.running, queued
+}
+
+// Cancel stops a running job or removes a queued one; it reports false for
+// unknown jobs and ones that have already finished
+func (m *JobManager) Cancel(id string) bool {
+    m.mu.Lock()
+    job := m.jobs[id]
+    if job == nil {
+        m.mu.Unlock()
+        return false
+    }
+    select {
+    case <-job.done:
+        m.mu.Unlock()
+        return false
+    default:
+    }
+    
+    queue := m.queue[job.Priority]
+    for i, queued := range queue {
+        if queued == job {
+            m.queue[job.Priority] = append(queue[:i:i], queue[i+1:]...)
+            m.dispatch()
+            m.mu.Unlock()
+            
+            job.cancel()
+            m.finish(job, map[string]interface{}{
+                "success": false,
+                "status":  InvocationCancelled,
+                "error":   "Cancelled while queued",
+            })
+            return true
+        }
+    }
+    m.mu.Unlock()
+    
+    job.cancel()
+    return true
+}
+
+// TestSuite is a declarative test suite loaded from the suites file
+type TestSuite struct {
+    Name           string       `json:"name"`
+    Description    string       `json:"description"`
+    Priority       string       `json:"priority,omitempty"`
+    Timeout        JSONDuration `json:"timeout,omitempty"`
+    Message        string       `json:"message"`
+    FailureMessage string       `json:"failure_message"`
+    Steps          []TestStep   `json:"steps"`
+}
+
+// TestStep calls one Dagger function. When it fails (or its output does
+// not meet Expect) its Fallback steps run instead, and the suite carries on
+// if they succeed.
+type TestStep struct {
+    Name     string       `json:"name"`
+    Function string       `json:"function"`
+    Args     []string     `json:"args,omitempty"`
+    Timeout  JSONDuration `json:"timeout,omitempty"`
+    Expect   []Assertion  `json:"expect,omitempty"`
+    Message  string       `json:"message,omitempty"`
+    Details  string       `json:"details,omitempty"`
+    Fallback []TestStep   `json:"fallback,omitempty"`
+}
+
+// Assertion is an expectation on a step's output:
+//
+//   - contains / not_contains: Value is a substring
+//   - regex: Value is a regular expression
+//   - json_path: the output is JSON and the value at Path equals Equals
+//   - threshold: the number at Path (or the whole output, if Path is
+//     empty) compared with Threshold using Op (>=, >, <=, <, ==, !=)
+type Assertion struct {
+    Type      string      `json:"type"`
+    Value     string      `json:"value,omitempty"`
+    Path      string      `json:"path,omitempty"`
+    Equals    interface{} `json:"equals,omitempty"`
+    Op        string      `json:"op,omitempty"`
+    Threshold *float64    `json:"threshold,omitempty"`
+    
+    re *regexp.Regexp
+}
+
+// AssertionResult is the outcome of one assertion in a step
+type AssertionResult struct {
+    Assertion string      `json:"assertion"`
+    Passed    bool        `json:"passed"`
+    Actual    interface{} `json:"actual,omitempty"`
+    Error     string      `json:"error,omitempty"`
+}
+
+// AssertionError reports output that did not meet a step's expectations
+type AssertionError struct {
+    Function string
+    Failed   []string
+}
+
+func (e *AssertionError) Error() string {
+    return fmt.Sprintf("%s output failed %s", e.Function, strings.Join(e.Failed, "; "))
+}
+
+// StepResult is the outcome of one step in a suite run
+type StepResult struct {
+    Name       string `json:"name"`
+    Function   string `json:"function"`
+    Status     string `json:"status"`
+    DurationMS int64  `json:"duration_ms"`
+    Error      string            `json:"error,omitempty"`
+    Fallback   bool              `json:"fallback,omitempty"`
+    Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// JSONDuration is a time.Duration written as a string such as "90s"
+type JSONDuration time.Duration
+
+func (d JSONDuration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *JSONDuration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return err
+    }
+    parsed, err := time.ParseDuration(s)
+    if err != nil {
+        return err
+    }
+    *d = JSONDuration(parsed)
+    return nil
+}
+
+// LoadTestSuites reads suite definitions from a JSON file holding
+// {"suites": [...]}, or from every *.json file in a directory
+func LoadTestSuites(path string) ([]*TestSuite, error) {
+    files := []string{path}
+    if info, err := os.Stat(path); err != nil {
+        return nil, err
+    } else if info.IsDir() {
+        if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+            return nil, err
+        }
+        sort.Strings(files)
+    }
+    
+    var suites []*TestSuite
+    seen := make(map[string]bool)
+    for _, file := range files {
+        data, err := os.ReadFile(file)
+        if err != nil {
+            return nil, err
+        }
+        var doc struct {
+            Suites []*TestSuite `json:"suites"`
+        }
+        if err := json.Unmarshal(data, &doc); err != nil {
+            return nil, fmt.Errorf("invalid suites file %s: %w", file, err)
+        }
+        for _, suite := range doc.Suites {
+            if err := suite.validate(); err != nil {
+                return nil, fmt.Errorf("%s: %w", file, err)
+            }
+            if seen[suite.Name] {
+                return nil, fmt.Errorf("%s: duplicate suite %q", file, suite.Name)
+            }
+            seen[suite.Name] = true
+            suites = append(suites, suite)
+        }
+    }
+    return suites, nil
+}
+
+func (suite *TestSuite) validate() error {
+    if suite.Name == "" {
+        return errors.New("suite without a name")
+    }
+    switch suite.Priority {
+    case "":
+        suite.Priority = PriorityInteractive
+    case PriorityInteractive, PriorityBackground:
+    default:
+        return fmt.Errorf("suite %q: invalid priority %q", suite.Name, suite.Priority)
+    }
+    if len(suite.Steps) == 0 {
+        return fmt.Errorf("suite %q has no steps", suite.Name)
+    }
+    return validateSteps(suite.Name, suite.Steps)
+}
+
+func validateSteps(suite string, steps []TestStep) error {
+    for i := range steps {
+        step := &steps[i]
+        if step.Function == "" {
+            return fmt.Errorf("suite %q: step %d has no function", suite, i+1)
+        }
+        if step.Name == "" {
+            step.Name = step.Function
+        }
+        for j := range step.Expect {
+            if err := step.Expect[j].validate(); err != nil {
+                return fmt.Errorf("suite %q, step %q: %w", suite, step.Name, err)
+            }
+        }
+        if err := validateSteps(suite, step.Fallback); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (a *Assertion) validate() error {
+    switch a.Type {
+    case "contains", "not_contains":
+        return nil
+    case "regex":
+        re, err := regexp.Compile(a.Value)
+        if err != nil {
+            return fmt.Errorf("invalid regex %q: %w", a.Value, err)
+        }
+        a.re = re
+        return nil
+    case "json_path":
+        if a.Path == "" {
+            return errors.New("json_path assertion needs a path")
+        }
+        return nil
+    case "threshold":
+        if a.Threshold == nil {
+            return errors.New("threshold assertion needs a threshold")
+        }
+        switch a.Op {
+        case ">=", ">", "<=", "<", "==", "!=":
+            return nil
+        default:
+            return fmt.Errorf("invalid threshold op %q", a.Op)
+        }
+    default:
+        return fmt.Errorf("unknown assertion type %q", a.Type)
+    }
+}
+
+// String describes the assertion for reports, e.g. `success_rate >= 0.8`
+func (a *Assertion) String() string {
+    switch a.Type {
+    case "contains":
+        return fmt.Sprintf("contains %q", a.Value)
+    case "not_contains":
+        return fmt.Sprintf("does not contain %q", a.Value)
+    case "regex":
+        return fmt.Sprintf("matches /%s/", a.Value)
+    case "json_path":
+        expected, _ := json.Marshal(a.Equals)
+        return fmt.Sprintf("%s == %s", a.Path, expected)
+    case "threshold":
+        subject := a.Path
+        if subject == "" {
+            subject = "output"
+        }
+        return fmt.Sprintf("%s %s %s", subject, a.Op, strconv.FormatFloat(*a.Threshold, 'g', -1, 64))
+    }
+    return a.Type
+}
+
+// Evaluate checks output against the assertion
+func (a *Assertion) Evaluate(output string) AssertionResult {
+    result := AssertionResult{Assertion: a.String()}
+    switch a.Type {
+    case "contains":
+        result.Passed = strings.Contains(output, a.Value)
+    case "not_contains":
+        result.Passed = !strings.Contains(output, a.Value)
+    case "regex":
+        if loc := a.re.FindStringIndex(output); loc != nil {
+            result.Passed = true
+            result.Actual = output[loc[0]:loc[1]]
+        }
+        
+    case "json_path":
+        actual, err := outputPath(output, a.Path)
+        if err != nil {
+            result.Error = err.Error()
+            break
+        }
+        result.Actual = actual
+        got, _ := json.Marshal(actual)
+        want, _ := json.Marshal(a.Equals)
+        result.Passed = bytes.Equal(got, want)
+        
+    case "threshold":
+        var value float64
+        if a.Path == "" {
+            parsed, err := strconv.ParseFloat(output, 64)
+            if err != nil {
+                result.Error = fmt.Sprintf("output is not a number: %q", output)
+                break
+            }
+            value = parsed
+        } else {
+            actual, err := outputPath(output, a.Path)
+            if err != nil {
+                result.Error = err.Error()
+                break
+            }
+            number, ok := actual.(float64)
+            if !ok {
+                result.Error = fmt.Sprintf("%s is not a number", a.Path)
+                result.Actual = actual
+                break
+            }
+            value = number
+        }
+        result.Actual = value
+        
+        limit := *a.Threshold
+        switch a.Op {
+        case ">=":
+            result.Passed = value >= limit
+        case ">":
+            result.Passed = value > limit
+        case "<=":
+            result.Passed = value <= limit
+        case "<":
+            result.Passed = value < limit
+        case "==":
+            result.Passed = value == limit
+        case "!=":
+            result.Passed = value != limit
+        }
+    }
+    return result
+}
+
+// outputPath parses output as JSON and looks up a dotted path such as
+// `components.agent_memory.status` or `$.agents[0].name`
+func outputPath(output, path string) (interface{}, error) {
+    var doc interface{}
+    if err := json.Unmarshal([]byte(output), &doc); err != nil {
+        return nil, fmt.Errorf("output is not JSON: %v", err)
+    }
+    
+    path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+    if path == "" {
+        return doc, nil
+    }
+    for _, part := range strings.Split(path, ".") {
+        key, index := part, ""
+        if i := strings.IndexByte(part, '['); i >= 0 {
+            key, index = part[:i], part[i:]
+        }
+        if key != "" {
+            object, ok := doc.(map[string]interface{})
+            if !ok {
+                return nil, fmt.Errorf("%s: not an object", key)
+            }
+            if doc, ok = object[key]; !ok {
+                return nil, fmt.Errorf("%s: no such key", key)
+            }
+        }
+        for index != "" {
+            end := strings.IndexByte(index, ']')
+            if !strings.HasPrefix(index, "[") || end < 0 {
+                return nil, fmt.Errorf("%s: bad index", part)
+            }
+            n, err := strconv.Atoi(index[1:end])
+            if err != nil {
+                return nil, fmt.Errorf("%s: bad index", part)
+            }
+            array, ok := doc.([]interface{})
+            if !ok || n < 0 || n >= len(array) {
+                return nil, fmt.Errorf("%s: index out of range", part)
+            }
+            doc, index = array[n], index[end+1:]
+        }
+    }
+    return doc, nil
+}
+
+// TestSuites indexes the loaded suites by name, keeping file order
+type TestSuites struct {
+    order  []*TestSuite
+    byName map[string]*TestSuite
+}
+
+func NewTestSuites(suites []*TestSuite) *TestSuites {
+    ts := &TestSuites{order: suites, byName: make(map[string]*TestSuite)}
+    for _, suite := range suites {
+        ts.byName[suite.Name] = suite
+    }
+    return ts
+}
+
+func (ts *TestSuites) Get(name string) *TestSuite {
+    return ts.byName[name]
+}
+
+func (ts *TestSuites) All() []*TestSuite {
+    return ts.order
+}
+
+// Command is a dashboard command: a named Dagger function call with typed
+// parameters that callers fill in through the command's args
+type Command struct {
+    Name        string         `json:"name"`
+    Description string         `json:"description"`
+    Function    string         `json:"function,omitempty"`
+    Params      []CommandParam `json:"params"`
+    
+    // run overrides calling Function, for commands that are not a single
+    // module function
+    run func(ctx context.Context, s *Server, args []string) (string, error)
+}
+
+// CommandParam is one argument of a command, passed to the function as
+// --name. Type is string, integer, number, boolean or array (of Items).
+type CommandParam struct {
+    Name        string      `json:"name"`
+    Type        string      `json:"type"`
+    Items       string      `json:"items,omitempty"`
+    DaggerType  string      `json:"dagger_type,omitempty"`
+    Description string      `json:"description"`
+    Required    bool        `json:"required,omitempty"`
+    Default     interface{} `json:"default,omitempty"`
+    Enum        []string    `json:"enum,omitempty"`
+    Minimum     *float64    `json:"minimum,omitempty"`
+    Maximum     *float64    `json:"maximum,omitempty"`
+}
+
+// Flags validates args against the command's parameters and returns the
+// matching dagger call flags, in parameter order, with defaults filled in
+func (c *Command) Flags(args map[string]interface{}) ([]string, error) {
+    known := make(map[string]bool, len(c.Params))
+    var flags []string
+    for _, param := range c.Params {
+        known[param.Name] = true
+        value, ok := args[param.Name]
+        if !ok || value == nil {
+            if param.Required {
+                return nil, fmt.Errorf("missing required argument %q", param.Name)
+            }
+            if param.Default == nil {
+                continue
+            }
+            value = param.Default
+        }
+        text, err := param.format(value)
+        if err != nil {
+            return nil, fmt.Errorf("argument %q: %w", param.Name, err)
+        }
+        if param.Type == "boolean" {
+            // A boolean flag only takes its value attached
+            flags = append(flags, "--"+param.Name+"="+text)
+        } else {
+            flags = append(flags, "--"+param.Name, text)
+        }
+    }
+    
+    for name := range args {
+        if !known[name] {
+            return nil, fmt.Errorf("unknown argument %q for command %s", name, c.Name)
+        }
+    }
+    return flags, nil
+}
+
+// format checks a JSON-decoded value against the parameter and renders it
+// as a flag value
+func (p CommandParam) format(value interface{}) (string, error) {
+    switch p.Type {
+    case "string":
+        text, ok := value.(string)
+        if !ok {
+            return "", fmt.Errorf("want a string, got %v", value)
+        }
+        if len(p.Enum) > 0 && !slices.Contains(p.Enum, text) {
+            return "", fmt.Errorf("%q is not one of %s", text, strings.Join(p.Enum, ", "))
+        }
+        return text, nil
+        
+    case "boolean":
+        b, ok := value.(bool)
+        if !ok {
+            return "", fmt.Errorf("want a boolean, got %v", value)
+        }
+        return strconv.FormatBool(b), nil
+        
+    case "integer", "number":
+        n, ok := value.(float64)
+        if !ok {
+            return "", fmt.Errorf("want a %s, got %v", p.Type, value)
+        }
+        if p.Type == "integer" && n != math.Trunc(n) {
+            return "", fmt.Errorf("want an integer, got %v", n)
+        }
+        if p.Minimum != nil && n < *p.Minimum {
+            return "", fmt.Errorf("%v is below the minimum %v", n, *p.Minimum)
+        }
+        if p.Maximum != nil && n > *p.Maximum {
+            return "", fmt.Errorf("%v is above the maximum %v", n, *p.Maximum)
+        }
+        return strconv.FormatFloat(n, 'f', -1, 64), nil
+        
+    case "array":
+        // The CLI takes list flags comma separated
+        items, ok := value.([]interface{})
+        if !ok {
+            return "", fmt.Errorf("want an array, got %v", value)
+        }
+        item := CommandParam{Type: p.Items, Enum: p.Enum}
+        texts := make([]string, len(items))
+        for i, v := range items {
+            text, err := item.format(v)
+            if err != nil {
+                return "", fmt.Errorf("item %d: %w", i, err)
+            }
+            texts[i] = text
+        }
+        return strings.Join(texts, ","), nil
+    }
+    return "", fmt.Errorf("unsupported parameter type %q", p.Type)
+}
+
+// Commands indexes the registered commands by name, keeping their order
+type Commands struct {
+    order  []*Command
+    byName map[string]*Command
+}
+
+func NewCommands(commands []*Command) *Commands {
+    cs := &Commands{order: commands, byName: make(map[string]*Command)}
+    for _, command := range commands {
+        if command.Params == nil {
+            command.Params = []CommandParam{}
+        }
+        cs.byName[command.Name] = command
+    }
+    return cs
+}
+
+func (cs *Commands) Get(name string) *Command {
+    return cs.byName[name]
+}
+
+func (cs *Commands) All() []*Command {
+    return cs.order
+}
+
+func bound(v float64) *float64 {
+    return &v
+}
+
+// builtinCommands are the commands behind the dashboard's quick actions and
+// the CLI's exec, each backed by a module function
+func builtinCommands() []*Command {
+    return []*Command{
+        {
+            Name:        "initialize",
+            Description: "Check that the module answers",
+            Function:    "test-connection",
+        },
+        {
+            Name:        "test",
+            Description: "List the module's functions (dagger functions) to check the system is operational",
+            run: func(ctx context.Context, s *Server, args []string) (string, error) {
+                result, err := s.functions(ctx)
+                if err != nil {
+                    return "", err
+                }
+                functions := parseFunctionListing(string(result))
+                return fmt.Sprintf("System operational - %d functions available", len(functions)), nil
+            },
+        },
+        {
+            Name:        "evolve",
+            Description: "Evolve the agent population into its next generation",
+            Function:    "trigger-evolution",
+            Params: []CommandParam{
+                {Name: "mutation-rate", Type: "number", Description: "Probability of mutating each trait", Minimum: bound(0), Maximum: bound(1)},
+                {Name: "crossover-rate", Type: "number", Description: "Probability of crossing over two parents", Minimum: bound(0), Maximum: bound(1)},
+                {Name: "elitism-count", Type: "integer", Description: "Fittest agents carried over unchanged", Minimum: bound(0)},
+                {Name: "fitness-threshold", Type: "number", Description: "Minimum fitness an agent needs to survive", Minimum: bound(0), Maximum: bound(1)},
+            },
+        },
+        {
+            Name:        "export",
+            Description: "Export the collective knowledge base",
+            Function:    "export-knowledge",
+            Params: []CommandParam{
+                {Name: "format", Type: "string", Description: "Export format", Default: "json"},
+            },
+        },
+        {
+            Name:        "learn",
+            Description: "Record an experience in collective memory",
+            Function:    "learn-from-experience",
+            Params: []CommandParam{
+                {Name: "experience", Type: "string", Description: `Experience as JSON, e.g. {"task":"deployment","success":true,"agents":["code","test"]}`, Required: true},
+            },
+        },
+        {
+            Name:        "snapshot",
+            Description: "Snapshot the system state for later comparison",
+            Function:    "create-system-snapshot",
+            Params: []CommandParam{
+                {Name: "name", Type: "string", Description: "Snapshot name", Required: true},
+            },
+        },
+        {
+            Name:        "status",
+            Description: "Report the module's own view of the system status",
+            Function:    "get-system-status",
+        },
+        {
+            Name:        "evolution-summary",
+            Description: "Summarise evolution across generations",
+            Function:    "get-evolution-summary",
+        },
+        {
+            Name:        "fitness-history",
+            Description: "Show fitness per generation",
+            Function:    "get-fitness-history",
+        },
+        {
+            Name:        "report",
+            Description: "Generate a full system report",
+            Function:    "generate-system-report",
+        },
+    }
+}
+
+// DaggerFunction is one module function as introspected from the CLI. Its
+// arguments are only known once Described is set.
+type DaggerFunction struct {
+    Name        string         `json:"name"`
+    Description string         `json:"description"`
+    Described   bool           `json:"described"`
+    Args        []CommandParam `json:"args,omitempty"`
+}
+
+// Command turns the function into a command, so calls are validated and
+// run exactly like dashboard commands
+func (f *DaggerFunction) Command() *Command {
+    return &Command{Name: f.Name, Description: f.Description, Function: f.Name, Params: f.Args}
+}
+
+var functionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// parseFunctionListing parses `dagger functions`: a "Name Description"
+// header, then one function per line with its description, "-" when it
+// has none. Any other line (progress output, blank lines) is skipped.
+func parseFunctionListing(output string) []DaggerFunction {
+    var functions []DaggerFunction
+    for _, line := range strings.Split(output, "\n") {
+        fields := strings.Fields(line)
+        if len(fields) == 0 || fields[0] == "Name" || !functionNamePattern.MatchString(fields[0]) {
+            continue
+        }
+        description := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+        if description == "-" {
+            description = ""
+        }
+        functions = append(functions, DaggerFunction{Name: fields[0], Description: description})
+    }
+    return functions
+}
+
+var (
+    // "--name string   Agent name [required]"; flags without a type are booleans
+    helpArgPattern     = regexp.MustCompile(`^\s+--([a-z][a-z0-9-]*)(?: (\S+))?(?:\s{2,}(.*))?$`)
+    helpEnumPattern    = regexp.MustCompile(`\(possible values: ([^)]*)\)`)
+    helpSectionPattern = regexp.MustCompile(`^[A-Z][A-Z ]+$`)
+)
+
+// parseFunctionHelp reads the ARGUMENTS section of `dagger call <function>
+// --help`. Module object types (Directory, Secret, ...) are passed as the
+// string the CLI accepts for them, such as a path or env:VAR.
+func parseFunctionHelp(output string) []CommandParam {
+    params := []CommandParam{}
+    inArguments := false
+    for _, line := range strings.Split(output, "\n") {
+        if helpSectionPattern.MatchString(line) {
+            inArguments = strings.TrimSpace(line) == "ARGUMENTS"
+            continue
+        }
+        match := helpArgPattern.FindStringSubmatch(line)
+        if !inArguments || match == nil {
+            continue
+        }
+        
+        param := CommandParam{Name: match[1], DaggerType: match[2], Description: strings.TrimSpace(match[3])}
+        if strings.Contains(param.Description, "[required]") {
+            param.Required = true
+            param.Description = strings.TrimSpace(strings.Replace(param.Description, "[required]", "", 1))
+        }
+        if enum := helpEnumPattern.FindStringSubmatch(param.Description); enum != nil {
+            param.Enum = strings.Split(enum[1], ", ")
+        }
+        switch param.DaggerType {
+        case "":
+            param.Type = "boolean"
+        case "int":
+            param.Type = "integer"
+        case "float":
+            param.Type = "number"
+        case "strings":
+            param.Type, param.Items = "array", "string"
+        case "ints":
+            param.Type, param.Items = "array", "integer"
+        case "floats":
+            param.Type, param.Items = "array", "number"
+        default:
+            param.Type = "string"
+        }
+        params = append(params, param)
+    }
+    return params
+}
+
+// FunctionCatalog holds the module's functions. The listing follows every
+// `dagger functions` run, including the status poller's; each function's
+// arguments are introspected on first use and kept until the listing
+// changes.
+type FunctionCatalog struct {
+    mu        sync.Mutex
+    listing   string
+    functions []*DaggerFunction
+    byName    map[string]*DaggerFunction
+}
+
+func NewFunctionCatalog() *FunctionCatalog {
+    return &FunctionCatalog{byName: make(map[string]*DaggerFunction)}
+}
+
+// SetListing replaces the catalog with a new `dagger functions` output,
+// keeping known signatures if the listing is unchanged
+func (fc *FunctionCatalog) SetListing(output []byte) {
+    fc.mu.Lock()
+    defer fc.mu.Unlock()
+    if string(output) == fc.listing {
+        return
+    }
+    
+    fc.listing = string(output)
+    fc.functions = nil
+    fc.byName = make(map[string]*DaggerFunction)
+    for _, function := range parseFunctionListing(fc.listing) {
+        function := function
+        fc.functions = append(fc.functions, &function)
+        fc.byName[function.Name] = &function
+    }
+}
+
+// Loaded reports whether any listing has been seen yet
+func (fc *FunctionCatalog) Loaded() bool {
+    fc.mu.Lock()
+    defer fc.mu.Unlock()
+    return fc.listing != ""
+}
+
+// All snapshots every function
+func (fc *FunctionCatalog) All() []DaggerFunction {
+    fc.mu.Lock()
+    defer fc.mu.Unlock()
+    functions := make([]DaggerFunction, len(fc.functions))
+    for i, function := range fc.functions {
+        functions[i] = *function
+    }
+    return functions
+}
+
+// Get snapshots one function
+func (fc *FunctionCatalog) Get(name string) (DaggerFunction, bool) {
+    fc.mu.Lock()
+    defer fc.mu.Unlock()
+    function, ok := fc.byName[name]
+    if !ok {
+        return DaggerFunction{}, false
+    }
+    return *function, true
+}
+
+// setArgs records a function's introspected arguments, unless the listing
+// has moved on and dropped the function meanwhile
+func (fc *FunctionCatalog) setArgs(name string, args []CommandParam) {
+    fc.mu.Lock()
+    defer fc.mu.Unlock()
+    if function, ok := fc.byName[name]; ok {
+        function.Args = args
+        function.Described = true
+    }
+}
+
+// reportCase is one suite step of a finished test run, as exported to CI
+type reportCase struct {
+    StepResult
+    Output string
+    // Recovered marks a failed step whose fallback steps ran in its place
+    Recovered bool
+}
+
+// reportCases recovers a test run's steps from its stored result. Every
+// step makes exactly one Dagger call, so steps and invocations pair up in
+// order.
+func reportCases(run JobView) []reportCase {
+    var steps []StepResult
+    if raw, err := json.Marshal(run.Result["steps"]); err == nil {
+        json.Unmarshal(raw, &steps)
+    }
+    
+    // A run that never reached a step (e.g. cancelled while queued) is
+    // reported as one case for the whole suite
+    if len(steps) == 0 {
+        status := InvocationOK
+        if run.State != JobSucceeded {
+            status, _ = run.Result["status"].(string)
+        }
+        message, _ := run.Result["error"].(string)
+        return []reportCase{{StepResult: StepResult{
+            Name:       run.Name,
+            Status:     status,
+            DurationMS: run.DurationMS,
+            Error:      message,
+        }}}
+    }
+    
+    cases := make([]reportCase, len(steps))
+    for i, step := range steps {
+        cases[i].StepResult = step
+        if i < len(run.Invocations) {
+            cases[i].Output = run.Invocations[i].Output
+        }
+        cases[i].Recovered = step.Status != InvocationOK && i+1 < len(steps) && steps[i+1].Fallback
+    }
+    return cases
+}
+
+// failureText describes why a case failed, including its assertions
+func (c reportCase) failureText() string {
+    var b strings.Builder
+    b.WriteString(c.Error)
+    for _, check := range c.Assertions {
+        mark := "PASS"
+        if !check.Passed {
+            mark = "FAIL"
+        }
+        fmt.Fprintf(&b, "\n%s %s", mark, check.Assertion)
+        if check.Actual != nil {
+            actual, _ := json.Marshal(check.Actual)
+            fmt.Fprintf(&b, " (actual %s)", actual)
+        }
+        if check.Error != "" {
+            fmt.Fprintf(&b, " (%s)", check.Error)
+        }
+    }
+    return b.String()
+}
+
+type junitTestSuites struct {
+    XMLName  xml.Name         `xml:"testsuites"`
+    Name     string           `xml:"name,attr"`
+    Tests    int              `xml:"tests,attr"`
+    Failures int              `xml:"failures,attr"`
+    Errors   int              `xml:"errors,attr"`
+    Time     string           `xml:"time,attr"`
+    Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+    Name       string          `xml:"name,attr"`
+    Tests      int             `xml:"tests,attr"`
+    Failures   int             `xml:"failures,attr"`
+    Errors     int             `xml:"errors,attr"`
+    Skipped    int             `xml:"skipped,attr"`
+    Time       string          `xml:"time,attr"`
+    Timestamp  string          `xml:"timestamp,attr,omitempty"`
+    Properties []junitProperty `xml:"properties>property"`
+    Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+    Name  string `xml:"name,attr"`
+    Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+    Name      string        `xml:"name,attr"`
+    Classname string        `xml:"classname,attr"`
+    Time      string        `xml:"time,attr"`
+    Failure   *junitProblem `xml:"failure,omitempty"`
+    Error     *junitProblem `xml:"error,omitempty"`
+    Skipped   *junitProblem `xml:"skipped,omitempty"`
+    SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+    Message string `xml:"message,attr"`
+    Type    string `xml:"type,attr,omitempty"`
+    Text    string `xml:",chardata"`
+}
+
+func junitSeconds(ms int64) string {
+    return strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64)
+}
+
+// writeJUnitReport renders a test run as JUnit XML: one testsuite with a
+// testcase per step. Failed steps are failures, timed out or cancelled
+// ones errors, and steps replaced by a fallback are skipped.
+func writeJUnitReport(w io.Writer, run JobView) error {
+    suite := junitTestSuite{
+        Name:      run.Name,
+        Time:      junitSeconds(run.DurationMS),
+        Timestamp: run.StartedAt,
+        Properties: []junitProperty{
+            {Name: "job_id", Value: run.ID},
+            {Name: "state", Value: run.State},
+            {Name: "initiator", Value: run.Initiator},
+        },
+    }
+    if simulated, _ := run.Result["simulated"].(bool); simulated {
+        suite.Properties = append(suite.Properties, junitProperty{Name: "simulated", Value: "true"})
+    }
+    
+    for _, c := range reportCases(run) {
+        tc := junitTestCase{
+            Name:      c.Name,
+            Classname: "proactiva." + run.Name,
+            Time:      junitSeconds(c.DurationMS),
+            SystemOut: c.Output,
+        }
+        switch {
+        case c.Recovered:
+            tc.Skipped = &junitProblem{Message: "replaced by fallback: " + c.Error}
+            suite.Skipped++
+        case c.Status == InvocationOK:
+        case c.Status == InvocationFailed:
+            tc.Failure = &junitProblem{Message: c.Error, Type: c.Status, Text: c.failureText()}
+            suite.Failures++
+        default:
+            tc.Error = &junitProblem{Message: c.Error, Type: c.Status, Text: c.failureText()}
+            suite.Errors++
+        }
+        suite.Cases = append(suite.Cases, tc)
+    }
+    suite.Tests = len(suite.Cases)
+    
+    report := junitTestSuites{
+        Name:     "proactiva",
+        Tests:    suite.Tests,
+        Failures: suite.Failures,
+        Errors:   suite.Errors,
+        Time:     suite.Time,
+        Suites:   []junitTestSuite{suite},
+    }
+    io.WriteString(w, xml.Header)
+    encoder := xml.NewEncoder(w)
+    encoder.Indent("", "  ")
+    if err := encoder.Encode(report); err != nil {
+        return err
+    }
+    _, err := io.WriteString(w, "\n")
+    return err
+}
+
+// writeTAPReport renders a test run as TAP version 13: one test point per
+// step with a YAML diagnostic block, and steps replaced by a fallback
+// marked SKIP
+func writeTAPReport(w io.Writer, run JobView) error {
+    cases := reportCases(run)
+    var b strings.Builder
+    fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(cases))
+    fmt.Fprintf(&b, "# suite %s, job %s, state %s\n", run.Name, run.ID, run.State)
+    
+    for i, c := range cases {
+        ok := "ok"
+        if c.Status != InvocationOK && !c.Recovered {
+            ok = "not ok"
+        }
+        fmt.Fprintf(&b, "%s %d - %s", ok, i+1, c.Name)
+        if c.Recovered {
+            fmt.Fprintf(&b, " # SKIP replaced by fallback")
+        }
+        b.WriteString("\n  ---\n")
+        if c.Function != "" {
+            fmt.Fprintf(&b, "  function: %s\n", c.Function)
+        }
+        fmt.Fprintf(&b, "  status: %s\n", c.Status)
+        fmt.Fprintf(&b, "  duration_ms: %d\n", c.DurationMS)
+        if c.Error != "" {
+            fmt.Fprintf(&b, "  message: %s\n", strconv.Quote(c.Error))
+        }
+        if len(c.Assertions) > 0 {
+            b.WriteString("  assertions:\n")
+            for _, check := range c.Assertions {
+                fmt.Fprintf(&b, "    - assertion: %s\n      passed: %t\n", strconv.Quote(check.Assertion), check.Passed)
+                if check.Actual != nil {
+                    actual, _ := json.Marshal(check.Actual)
+                    fmt.Fprintf(&b, "      actual: %s\n", actual)
+                }
+                if check.Error != "" {
+                    fmt.Fprintf(&b, "      error: %s\n", strconv.Quote(check.Error))
+                }
+            }
+        }
+        if output := strings.TrimRight(c.Output, "\n"); output != "" {
+            b.WriteString("  output: |\n")
+            for _, line := range strings.Split(output, "\n") {
+                fmt.Fprintf(&b, "    %s\n", line)
+            }
+        }
+        b.WriteString("  ...\n")
+    }
+    
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+// Server holds the dependencies shared by all HTTP handlers
+type Server struct {
+    runner   DaggerRunner
+    timeouts DaggerTimeouts
+    status   *StatusCache
+    metrics  *MetricsStore
+    runs     *RunStore
+    suites   *TestSuites
+    commands *Commands
+    catalog  *FunctionCatalog
+    agents   *AgentStore
+    origins  []string
+    prom     *PromRegistry
+    tracer   *Tracer
+    events   *EventBus
+    jobs     *JobManager
+    simulate bool
+    
+    sseRetry     time.Duration
+    sseHeartbeat time.Duration
+    taskBackoff  time.Duration
+    
+    eventsMu      sync.Mutex
+    lastConnected *bool
+    lastStatus    []byte
+}
+
+// storePath locates a store in the data directory. Synthetic samples and
+// runs never mix with the real history.
+func storePath(cfg ServerConfig, name string) string {
+    if cfg.Simulate {
+        name += "-simulated"
+    }
+    return filepath.Join(cfg.DataDir, name+".jsonl")
+}
+
+func NewServer(runner DaggerRunner, cfg ServerConfig) (*Server, error) {
+    tracer, err := NewTracer("proactiva-web-server", cfg.OTLPEndpoint, cfg.TraceFile)
+    if err != nil {
+        return nil, err
+    }
+    
+    metrics, err := OpenMetricsStore(storePath(cfg, "metrics"), cfg.MetricsRetention)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open metrics store: %w", err)
+    }
+    runs, err := OpenRunStore(storePath(cfg, "runs"), cfg.RunsRetention)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open run store: %w", err)
+    }
+    suites, err := LoadTestSuites(cfg.TestSuites)
+    if errors.Is(err, os.ErrNotExist) {
+        // Deployments that only ship the binary and dashboard.html still
+        // serve the dashboard, just without suites to run
+        log.Printf("test suites: %v; serving no suites", err)
+        suites = []*TestSuite{}
+    } else if err != nil {
+        return nil, fmt.Errorf("failed to load test suites: %w", err)
+    }
+    agents, err := OpenAgentStore(storePath(cfg, "agents"))
+    if err != nil {
+        return nil, fmt.Errorf("failed to open agent store: %w", err)
+    }
+    
+    s := &Server{
+        runner:       runner,
+        timeouts:     cfg.Timeouts,
+        metrics:      metrics,
+        runs:         runs,
+        suites:       NewTestSuites(suites),
+        commands:     NewCommands(builtinCommands()),
+        catalog:      NewFunctionCatalog(),
+        agents:       agents,
+        origins:      cfg.AllowedOrigins,
+        prom:         NewPromRegistry(),
+        tracer:       tracer,
+        events:       NewEventBus(64, cfg.EventReplay),
+        simulate:     cfg.Simulate,
+        sseRetry:     cfg.SSERetry,
+        sseHeartbeat: cfg.SSEHeartbeat,
+        taskBackoff:  agentTaskBackoff,
+    }
+    s.jobs = NewJobManager(s.events, 500, cfg.MaxConcurrent, cfg.QueueSize)
+    s.jobs.OnFinish(runs.record)
+    s.status = NewStatusCache(s.getRealSystemStatus, cfg.StatusInterval)
+    return s, nil
+}
+
+// startServing takes on what only the long-running server owns, so CLI
+// subcommands sharing the data directory leave it alone: the event log,
+// recording and announcing status snapshots, the status poller and store
+// compaction
+func (s *Server) startServing(ctx context.Context, cfg ServerConfig) error {
+    if cfg.EventLog != "" {
+        if err := s.events.OpenEventLog(cfg.EventLog); err != nil {
+            return fmt.Errorf("failed to open event log: %w", err)
+        }
+    }
+    s.status.OnUpdate(s.metrics.recordStatus)
+    s.status.OnUpdate(s.publishStatus)
+    
+    go s.status.Run(ctx)
+    go s.metrics.RunCompaction(ctx, time.Hour)
+    go s.runs.RunCompaction(ctx, time.Hour)
+    return nil
+}
+
+// call invokes a Dagger function bounded by its configured deadline and
+// by ctx, so a disconnected client cancels the subprocess
+func (s *Server) call(ctx context.Context, function string, args ...string) ([]byte, error) {
+    return s.callWithTimeout(ctx, 0, function, args...)
+}
+
+// callWithTimeout is call with an explicit deadline; zero means the
+// function's configured one
+func (s *Server) callWithTimeout(ctx context.Context, timeout time.Duration, function string, args ...string) ([]byte, error) {
+    if timeout <= 0 {
+        timeout = s.timeouts.For(function)
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    
+    job := jobFromContext(ctx)
+    if job != nil {
+        ctx = WithLogSink(ctx, func(stream, line string) {
+            job.appendLog(function, stream, line)
+        })
+    }
+    
+    ctx, span := s.tracer.Start(ctx, "dagger call "+function, SpanKindClient, "")
+    span.SetAttribute("dagger.function", function)
+    span.SetAttribute("dagger.args", args)
+    
+    start := time.Now()
+    output, err := s.runner.Call(ctx, function, args...)
+    err = classifyDaggerError(ctx, function, timeout, err)
+    s.prom.ObserveDagger(function, invocationStatus(err), time.Since(start))
+    s.publishInvocation(function, args, err)
+    
+    if job != nil {
+        job.recordInvocation(JobInvocation{
+            Function:   function,
+            Args:       append([]string{}, args...),
+            Status:     invocationStatus(err),
+            ExitCode:   exitCodeOf(err),
+            DurationMS: time.Since(start).Milliseconds(),
+            Output:     string(output),
+        })
+    }
+    
+    endDaggerSpan(span, err, time.Since(start))
+    return output, err
+}
+
+// functions lists the module functions bounded by the "functions"
+// deadline, and keeps the function catalog in step with the listing
+func (s *Server) functions(ctx context.Context) ([]byte, error) {
+    output, err := s.introspect(ctx, "functions", "dagger functions", s.runner.Functions)
+    if err == nil {
+        s.catalog.SetListing(output)
+    }
+    return output, err
+}
+
+// functionHelp returns `dagger call <function> --help`
+func (s *Server) functionHelp(ctx context.Context, function string) ([]byte, error) {
+    return s.introspect(ctx, "help", "dagger call "+function+" --help", func(ctx context.Context) ([]byte, error) {
+        return s.runner.Help(ctx, function)
+    })
+}
+
+// introspect runs a module introspection command with the deadline,
+// tracing and metrics of a function call
+func (s *Server) introspect(ctx context.Context, name, spanName string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+    timeout := s.timeouts.For(name)
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    
+    ctx, span := s.tracer.Start(ctx, spanName, SpanKindClient, "")
+    span.SetAttribute("dagger.function", name)
+    
+    start := time.Now()
+    output, err := fn(ctx)
+    err = classifyDaggerError(ctx, name, timeout, err)
+    s.prom.ObserveDagger(name, invocationStatus(err), time.Since(start))
+    
+    endDaggerSpan(span, err, time.Since(start))
+    return output, err
+}
+
+// exitCodeOf returns the dagger process exit code, or -1 when the call
+// failed without one (e.g. it was killed or never started)
+func exitCodeOf(err error) int {
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        return exitErr.ExitCode()
+    }
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+// endDaggerSpan records the invocation outcome, exit code and duration
+func endDaggerSpan(span *Span, err error, duration time.Duration) {
+    span.SetAttribute("dagger.status", invocationStatus(err))
+    span.SetAttribute("process.exit.code", exitCodeOf(err))
+    span.SetAttribute("dagger.duration_ms", duration.Milliseconds())
+    span.SetError(err)
+    span.End()
+}
+
+func classifyDaggerError(ctx context.Context, function string, timeout time.Duration, err error) error {
+    if err == nil {
+        return nil
+    }
+    
+    status := InvocationFailed
+    switch {
+    case errors.Is(ctx.Err(), context.DeadlineExceeded):
+        status = InvocationTimedOut
+    case errors.Is(ctx.Err(), context.Canceled):
+        status = InvocationCancelled
+    }
+    return &DaggerError{Function: function, Status: status, Timeout: timeout, Err: err}
+}
+
+// cors lets any web page read the API, but only the dashboard's origin and
+// PROACTIVA_ALLOWED_ORIGINS change state. Browsers send a simple POST
+// cross-site without asking first, so such requests from other origins are
+// refused outright rather than merely left unreadable.
+func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        allowed := s.allowedOrigin(r)
+        if allowed {
+            if origin := r.Header.Get("Origin"); origin != "" {
+                w.Header().Set("Access-Control-Allow-Origin", origin)
+                w.Header().Add("Vary", "Origin")
+            }
+            w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+        } else {
+            w.Header().Set("Access-Control-Allow-Origin", "*")
+            w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+        }
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+        
+        if r.Method == "OPTIONS" {
+            w.WriteHeader(http.StatusOK)
+            return
+        }
+        if !allowed && r.Method != http.MethodGet && r.Method != http.MethodHead {
+            writeJSONError(w, http.StatusForbidden, "origin not allowed")
+            return
+        }
+        
+        next(w, r)
+    }
+}
+
+// allowedOrigin reports whether a request comes from the dashboard itself
+// (an Origin whose host is the one the request was sent to) or from an
+// origin in PROACTIVA_ALLOWED_ORIGINS. Requests without an Origin, such as
+// curl or the CLI, do not come from a web page and are allowed.
+func (s *Server) allowedOrigin(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    if origin == "" || slices.Contains(s.origins, origin) {
+        return true
+    }
+    u, err := url.Parse(origin)
+    return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Check if Dagger is running and get real function count
+func (s *Server) getDaggerStatus(ctx context.Context) (bool, int) {
+    output, err := s.functions(ctx)
+    if err != nil {
+        return false, 0
+    }
+    
+    return true, len(parseFunctionListing(string(output)))
+}
+
+// StatusDocument is the JSON document returned by
+// `dagger call get-system-status`. Fields are pointers so a
+// missing field can be told apart from a real zero.
+type StatusDocument struct {
+    Agents          *int                 `json:"agents"`
+    Generation      *int                 `json:"generation"`
+    FitnessScore    *float64             `json:"fitness_score"`
+    SuccessRate     *float64             `json:"success_rate"`
+    ActiveWorkflows *int                 `json:"active_workflows"`
+    MemoryUsageMB   *float64             `json:"memory_usage_mb"`
+    Components      map[string]Component `json:"components"`
+}
+
+// parseStatusDocument decodes get-system-status output. The CLI may wrap
+// the document in log lines, which can contain braces themselves, so the
+// first complete JSON object in the output is decoded. Fields this server
+// does not know are ignored so a newer module does not degrade the status.
+func parseStatusDocument(output []byte) (StatusDocument, error) {
+    var doc StatusDocument
+    
+    for i := bytes.IndexByte(output, '{'); i >= 0; {
+        var value json.RawMessage
+        if err := json.NewDecoder(bytes.NewReader(output[i:])).Decode(&value); err == nil {
+            if err := json.Unmarshal(value, &doc); err != nil {
+                return doc, fmt.Errorf("invalid get-system-status document: %w", err)
+            }
+            var fields map[string]json.RawMessage
+            json.Unmarshal(value, &fields)
+            logUnknownStatusFields(fields)
+            return doc, nil
+        }
+        next := bytes.IndexByte(output[i+1:], '{')
+        if next < 0 {
+            break
+        }
+        i += next + 1
+    }
+    return doc, fmt.Errorf("get-system-status returned no JSON document")
+}
+
+// loggedStatusFields remembers the unknown get-system-status fields
+// already logged, so each is only reported once
+var loggedStatusFields sync.Map
+
+func logUnknownStatusFields(raw map[string]json.RawMessage) {
+    for field := range raw {
+        if slices.Contains(statusFields, field) {
+            continue
+        }
+        if _, logged := loggedStatusFields.LoadOrStore(field, true); !logged {
+            log.Printf("status: ignoring unknown get-system-status field %q", field)
+        }
+    }
+}
+
+// apply copies every field present in the document onto status
+func (doc StatusDocument) apply(status *SystemStatus) {
+    if doc.Agents != nil {
+        status.Agents = *doc.Agents
+        status.Sources["agents"] = SourceDagger
+    }
+    if doc.Generation != nil {
+        status.Generation = *doc.Generation
+        status.Sources["generation"] = SourceDagger
+    }
+    if doc.FitnessScore != nil {
+        status.FitnessScore = *doc.FitnessScore
+        status.Sources["fitness_score"] = SourceDagger
+    }
+    if doc.SuccessRate != nil {
+        status.SuccessRate = *doc.SuccessRate
+        status.Sources["success_rate"] = SourceDagger
+    }
+    if doc.ActiveWorkflows != nil {
+        status.ActiveWorkflows = *doc.ActiveWorkflows
+        status.Sources["active_workflows"] = SourceDagger
+    }
+    if doc.MemoryUsageMB != nil {
+        status.MemoryUsageMB = *doc.MemoryUsageMB
+        status.Sources["memory_usage_mb"] = SourceDagger
+    }
+    if doc.Components != nil {
+        for name, component := range doc.Components {
+            status.Components[name] = component
+        }
+        status.Sources["components"] = SourceDagger
+    }
+}
+
+// Try to get real system status from Dagger. Fields Dagger does not report
+// stay at their zero value with source "unknown"; nothing is made up.
+func (s *Server) getRealSystemStatus(ctx context.Context) SystemStatus {
+    ctx, span := s.tracer.Start(ctx, "status refresh", SpanKindInternal, "")
+    defer span.End()
+    
+    isConnected, functionCount := s.getDaggerStatus(ctx)
+    
+    status := SystemStatus{
+        Timestamp:  time.Now().Format(time.RFC3339),
+        Status:     "DISCONNECTED",
+        Components: make(map[string]Component),
+        Sources:    unknownSources(),
+    }
+    
+    if isConnected {
+        status.Status = "CONNECTED"
+        status.Connected = true
+        status.TotalFunctions = functionCount
+        status.Sources["total_functions"] = SourceDagger
+        
+        // Try to get real status from Dagger
+        output, err := s.call(ctx, "get-system-status")
+        if err == nil {
+            var doc StatusDocument
+            if doc, err = parseStatusDocument(output); err == nil {
+                doc.apply(&status)
+            }
+        }
+        if err != nil {
+            // Dagger answers but the module does not: report it degraded,
+            // whether the call failed or its output did not parse, rather
+            // than connected with zeroed figures
+            status.Status = "DEGRADED"
+            status.Error = err.Error()
+        }
+    }
+    
+    if s.simulate {
+        status.Status = "SIMULATED"
+        for field, source := range status.Sources {
+            if source == SourceDagger {
+                status.Sources[field] = SourceSimulated
+            }
+        }
+    }
+    
+    return status
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    status := s.status.Get(r.Context())
+    json.NewEncoder(w).Encode(status)
+}
+
+// metricsHandler serves recorded samples. Query parameters: from and to
+// (RFC3339 or unix seconds, default the last hour) and step (duration such
+// as "1m", default 1m; "0" returns raw samples).
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    query := r.URL.Query()
+    now := time.Now()
+    
+    from, err := parseTimeParam(query.Get("from"), now.Add(-time.Hour))
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+        return
+    }
+    to, err := parseTimeParam(query.Get("to"), now)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+        return
+    }
+    if to.Before(from) {
+        writeJSONError(w, http.StatusBadRequest, "to must not be before from")
+        return
+    }
+    
+    step := time.Minute
+    if v := query.Get("step"); v != "" {
+        if v == "0" {
+            step = 0
+        } else if step, err = time.ParseDuration(v); err != nil || step < 0 {
+            writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid step: %q", v))
+            return
+        }
+    }
+    
+    json.NewEncoder(w).Encode(s.metrics.Query(from, to, step))
+}
+
+// parseTimeParam accepts RFC3339 timestamps or unix seconds
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+    if value == "" {
+        return fallback, nil
+    }
+    if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+        return time.Unix(secs, 0), nil
+    }
+    return time.Parse(time.RFC3339, value)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// EventReplayTruncated tells a resuming client that events it missed are
+// gone from the replay ring, so it should refetch state
+const EventReplayTruncated = "replay_truncated"
+
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+    
+    // Browsers send Last-Event-ID on reconnect; the query parameter serves
+    // clients that cannot set headers
+    lastID := r.Header.Get("Last-Event-ID")
+    if lastID == "" {
+        lastID = r.URL.Query().Get("lastEventId")
+    }
+    var resumeFrom uint64
+    if lastID != "" {
+        id, err := strconv.ParseUint(lastID, 10, 64)
+        if err != nil {
+            http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+            return
+        }
+        resumeFrom = id
+    }
+    
+    filter, err := ParseEventFilter(r.URL.Query())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    // Subscribe before the initial event so nothing published in between is lost
+    sub, replay, truncated := s.events.SubscribeFrom(resumeFrom, filter)
+    defer s.events.Unsubscribe(sub)
+    
+    fmt.Fprintf(w, "retry: %d\n\n", s.sseRetry.Milliseconds())
+    
+    // Send initial connection event
+    if connected := statusEvent(EventSystemConnected, s.status.Get(r.Context())); filter.Match(connected) {
+        writeSSE(w, connected)
+    }
+    if truncated {
+        writeSSE(w, NewEvent(EventReplayTruncated, map[string]interface{}{
+            "last_event_id": resumeFrom,
+        }))
+    }
+    for _, event := range replay {
+        writeSSE(w, event)
+    }
+    flusher.Flush()
+    
+    // Comment lines keep proxies from closing an idle stream
+    heartbeat := time.NewTicker(s.sseHeartbeat)
+    defer heartbeat.Stop()
+    
+    for {
+        select {
+        case event, ok := <-sub.C:
+            if !ok {
+                // Dropped as a slow consumer; the client will reconnect
+                return
+            }
+            writeSSE(w, event)
+            flusher.Flush()
+            
+        case <-heartbeat.C:
+            fmt.Fprintf(w, ": heartbeat %s\n\n", time.Now().Format(time.RFC3339))
+            flusher.Flush()
+            
+        case <-r.Context().Done():
+            return
+        }
+    }
+}
+
+// writeSSE writes one named event frame. Events that never went through
+// the bus carry no ID, which leaves the client's last event ID untouched.
+func writeSSE(w io.Writer, event Event) {
+    data, _ := json.Marshal(event.data())
+    if event.ID != 0 {
+        fmt.Fprintf(w, "id: %d\n", event.ID)
+    }
+    fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+func (s *Server) executeHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    var request struct {
+        Command  string                 `json:"command"`
+        Args     map[string]interface{} `json:"args"`
+        Priority string                 `json:"priority"`
+    }
+    
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+        return
+    }
+    
+    spec, run, err := s.prepareCommand(request.Command, request.Args)
+    if errors.Is(err, ErrUnknownCommand) {
+        writeJSONError(w, http.StatusNotFound, err.Error())
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    spec.Initiator = requestInitiator("http", r)
+    spec.Priority = request.Priority
+    s.startJob(w, r, spec, run)
+}
+
+// commandsHandler serves GET /api/commands: every command with its
+// argument schema
+func (s *Server) commandsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(s.commands.All())
+}
+
+// functionsHandler serves GET /api/functions: the module's functions from
+// `dagger functions`. With ?describe=true every function's arguments are
+// introspected first; otherwise only those already looked up are included.
+func (s *Server) functionsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if !s.catalog.Loaded() {
+        err := s.withWorker(r.Context(), func() error {
+            _, err := s.functions(r.Context())
+            return err
+        })
+        if errors.Is(err, ErrQueueFull) {
+            writeJSONError(w, http.StatusTooManyRequests, err.Error())
+            return
+        }
+        if err != nil {
+            writeJSONError(w, http.StatusBadGateway, err.Error())
+            return
+        }
+    }
+    
+    if r.URL.Query().Get("describe") == "true" {
+        // Every --help starts the module and takes a worker, so one
+        // request only queues a few at once
+        sem := make(chan struct{}, 4)
+        var wg sync.WaitGroup
+        for _, function := range s.catalog.All() {
+            if function.Described {
+                continue
+            }
+            wg.Add(1)
+            sem <- struct{}{}
+            go func(name string) {
+                defer func() { <-sem; wg.Done() }()
+                if _, err := s.describeFunction(r.Context(), name); err != nil {
+                    log.Printf("describing %s: %v", name, err)
+                }
+            }(function.Name)
+        }
+        wg.Wait()
+    }
+    json.NewEncoder(w).Encode(s.catalog.All())
+}
+
+// functionHandler serves GET /api/functions/{name}, the function with its
+// arguments, and POST /api/functions/{name}, which calls it with the JSON
+// object in the body as arguments. Calls run as jobs of kind "function"
+// and answer like POST /api/execute.
+func (s *Server) functionHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.Method != http.MethodGet && r.Method != http.MethodPost {
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    
+    function, err := s.describeFunction(r.Context(), r.PathValue("name"))
+    if errors.Is(err, ErrUnknownFunction) {
+        writeJSONError(w, http.StatusNotFound, err.Error())
+        return
+    }
+    if errors.Is(err, ErrQueueFull) {
+        writeJSONError(w, http.StatusTooManyRequests, err.Error())
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusBadGateway, err.Error())
+        return
+    }
+    if r.Method == http.MethodGet {
+        json.NewEncoder(w).Encode(function)
+        return
+    }
+    
+    var args map[string]interface{}
+    if err := json.NewDecoder(r.Body).Decode(&args); err != nil && !errors.Is(err, io.EOF) {
+        writeJSONError(w, http.StatusBadRequest, "Invalid arguments: "+err.Error())
+        return
+    }
+    command := function.Command()
+    flags, err := command.Flags(args)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    
+    spec := JobSpec{
+        Kind:      "function",
+        Name:      function.Name,
+        Args:      map[string]interface{}{"function": function.Name},
+        Initiator: requestInitiator("http", r),
+        Priority:  r.URL.Query().Get("priority"),
+    }
+    if len(args) > 0 {
+        spec.Args["args"] = args
+    }
+    s.startJob(w, r, spec, func(ctx context.Context) map[string]interface{} {
+        return s.executeCommand(ctx, command, flags)
+    })
+}
+
+// withWorker runs fn on a worker from the job pool, for Dagger calls a
+// handler makes itself rather than through a job
+func (s *Server) withWorker(ctx context.Context, fn func() error) error {
+    release, err := s.jobs.Acquire(ctx)
+    if err != nil {
+        return err
+    }
+    defer release()
+    return fn()
+}
+
+// ErrUnknownFunction is returned for a function the module does not have
+var ErrUnknownFunction = errors.New("unknown function")
+
+// describeFunction returns a function with its arguments, introspecting
+// them on first use on a worker from the job pool
+func (s *Server) describeFunction(ctx context.Context, name string) (DaggerFunction, error) {
+    if !s.catalog.Loaded() {
+        err := s.withWorker(ctx, func() error {
+            _, err := s.functions(ctx)
+            return err
+        })
+        if err != nil {
+            return DaggerFunction{}, err
+        }
+    }
+    function, ok := s.catalog.Get(name)
+    if !ok {
+        return function, fmt.Errorf("%w %q", ErrUnknownFunction, name)
+    }
+    if function.Described {
+        return function, nil
+    }
+    
+    var help []byte
+    err := s.withWorker(ctx, func() (err error) {
+        help, err = s.functionHelp(ctx, name)
+        return err
+    })
+    if err != nil {
+        return function, err
+    }
+    function.Args, function.Described = parseFunctionHelp(string(help)), true
+    s.catalog.setArgs(name, function.Args)
+    return function, nil
+}
+
+// AgentType is one of the module's specialised agents: the function that
+// creates it and the options that function takes besides the agent's name.
+// Options are named as in the API; the function takes them kebab-cased.
+type AgentType struct {
+    Name     string         `json:"name"`
+    Function string         `json:"function"`
+    Options  []CommandParam `json:"options"`
+}
+
+var agentTypes = []AgentType{
+    {Name: "code", Function: "create-code-agent", Options: []CommandParam{
+        {Name: "language", Type: "string", Description: "Language the agent writes, such as typescript or go"},
+    }},
+    {Name: "test", Function: "create-test-agent", Options: []CommandParam{
+        {Name: "framework", Type: "string", Description: "Test framework, such as jest or pytest"},
+    }},
+    {Name: "security", Function: "create-security-agent", Options: []CommandParam{
+        {Name: "scanType", Type: "string", Description: "Kind of scan, such as dependencies or sast"},
+    }},
+    {Name: "performance", Function: "create-performance-agent", Options: []CommandParam{
+        {Name: "metrics", Type: "array", Items: "string", Description: "Metrics to profile, such as latency or memory"},
+    }},
+    {Name: "review", Function: "create-review-agent", Options: []CommandParam{
+        {Name: "criteria", Type: "array", Items: "string", Description: "Review criteria, such as readability or complexity"},
+    }},
+}
+
+func agentType(name string) (AgentType, bool) {
+    for _, t := range agentTypes {
+        if t.Name == name {
+            return t, true
+        }
+    }
+    return AgentType{}, false
+}
+
+// flags validates the options for creating an agent of this type and
+// returns the create function's flags
+func (t AgentType) flags(name string, options map[string]interface{}) ([]string, error) {
+    command := &Command{
+        Name:     t.Function,
+        Function: t.Function,
+        Params:   []CommandParam{{Name: "name", Type: "string", Required: true}},
+    }
+    args := map[string]interface{}{"name": name}
+    for _, option := range t.Options {
+        option.Name = kebabCase(option.Name)
+        command.Params = append(command.Params, option)
+    }
+    for key, value := range options {
+        if !slices.ContainsFunc(t.Options, func(p CommandParam) bool { return p.Name == key }) {
+            return nil, fmt.Errorf("unknown option %q for %s agents", key, t.Name)
+        }
+        args[kebabCase(key)] = value
+    }
+    return command.Flags(args)
+}
+
+// agentMemoryKeyPattern keeps memory keys usable as file names in the
+// agent's memory cache
+var agentMemoryKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// agentNamePattern keeps names usable as agent IDs, which the module puts in
+// cache volume names and the API in URL paths
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// agentIDPattern finds an agent ID in create output such as
+// "Agent ID: code-1712345678901"
+var agentIDPattern = regexp.MustCompile(`(?i)\bagent[ _-]?id\b["']?\s*[:=]\s*["']?([A-Za-z0-9_][A-Za-z0-9_.-]*)`)
+
+// moduleAgentID returns the ID a create function reported for its agent,
+// from an "agentId" (or "agent_id") field when the output is JSON, or an
+// "agent id: ..." line otherwise. It is empty when there is none.
+func moduleAgentID(output string) string {
+    var doc map[string]interface{}
+    if json.Unmarshal([]byte(output), &doc) == nil {
+        for _, key := range []string{"agentId", "agent_id"} {
+            if id, ok := doc[key].(string); ok && agentNamePattern.MatchString(id) {
+                return id
+            }
+        }
+        return ""
+    }
+    if match := agentIDPattern.FindStringSubmatch(output); match != nil {
+        return match[1]
+    }
+    return ""
+}
+
+// agentsHandler serves /api/agents: GET lists the registered agents,
+// optionally of one ?type=, and POST creates one as a job
+func (s *Server) agentsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    switch r.Method {
+    case http.MethodGet:
+        json.NewEncoder(w).Encode(s.agents.List(r.URL.Query().Get("type")))
+    case http.MethodPost:
+        s.createAgent(w, r)
+    default:
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+func (s *Server) createAgent(w http.ResponseWriter, r *http.Request) {
+    var request struct {
+        Name     string                 `json:"name"`
+        Type     string                 `json:"type"`
+        Options  map[string]interface{} `json:"options"`
+        Priority string                 `json:"priority"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+        return
+    }
+    
+    t, ok := agentType(request.Type)
+    if !ok {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown agent type %q (want code, test, security, performance or review)", request.Type))
+        return
+    }
+    if request.Name == "" {
+        writeJSONError(w, http.StatusBadRequest, "missing agent name")
+        return
+    }
+    if !agentNamePattern.MatchString(request.Name) {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid agent name %q (letters, digits, _, . and -)", request.Name))
+        return
+    }
+    flags, err := t.flags(request.Name, request.Options)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    release, err := s.agents.Reserve(request.Name)
+    if err != nil {
+        writeJSONError(w, http.StatusConflict, err.Error())
+        return
+    }
+    
+    agent := Agent{
+        Name:     request.Name,
+        Type:     t.Name,
+        Function: t.Function,
+        Options:  request.Options,
+    }
+    spec := JobSpec{
+        Kind:      "agent",
+        Name:      agent.Name,
+        Args:      map[string]interface{}{"type": agent.Type, "name": agent.Name},
+        Initiator: requestInitiator("http", r),
+        Priority:  request.Priority,
+    }
+    if len(request.Options) > 0 {
+        spec.Args["options"] = request.Options
+    }
+    job := s.startJob(w, r, spec, func(ctx context.Context) map[string]interface{} {
+        output, err := s.call(ctx, t.Function, flags...)
+        if err != nil {
+            return testFailure(err, fmt.Sprintf("Creating %s agent %s failed", t.Name, agent.Name))
+        }
+        
+        agent.Output = strings.TrimSpace(string(output))
+        // The create functions take no ID, so the follow-up calls use the
+        // one the module reports, or the name when it reports none
+        agent.ID = moduleAgentID(agent.Output)
+        if agent.ID == "" {
+            agent.ID = agent.Name
+        }
+        agent.CreatedAt = time.Now().Format(time.RFC3339)
+        if err := s.agents.Add(agent); err != nil {
+            return map[string]interface{}{
+                "success": false,
+                "status":  InvocationFailed,
+                "error":   "Agent created but not registered: " + err.Error(),
+            }
+        }
+        return map[string]interface{}{
+            "success": true,
+            "status":  InvocationOK,
+            "output":  agent.Output,
+            "agent":   agent,
+        }
+    })
+    if job == nil {
+        release()
+        return
+    }
+    // A job cancelled while queued never runs, so the name is freed when
+    // the job is done rather than at the end of the function
+    go func() {
+        <-job.Done()
+        release()
+    }()
+}
+
+// agentTypesHandler serves GET /api/agents/types: the agent types with the
+// options each takes
+func (s *Server) agentTypesHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(agentTypes)
+}
+
+// agentHandler serves GET and DELETE /api/agents/{id}. The module cannot
+// destroy an agent, whose container only exists while it runs, so DELETE
+// forgets it; its memory cache volume is left to Dagger's cache pruning.
+func (s *Server) agentHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    id := r.PathValue("id")
+    switch r.Method {
+    case http.MethodGet:
+        agent, ok := s.agents.Get(id)
+        if !ok {
+            writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%v %q", ErrUnknownAgent, id))
+            return
+        }
+        json.NewEncoder(w).Encode(agent)
+        
+    case http.MethodDelete:
+        agent, err := s.agents.Delete(id)
+        if errors.Is(err, ErrUnknownAgent) {
+            writeJSONError(w, http.StatusNotFound, err.Error())
+            return
+        }
+        if err != nil {
+            writeJSONError(w, http.StatusInternalServerError, err.Error())
+            return
+        }
+        s.events.Publish(NewEvent(EventAgentDeleted, map[string]interface{}{
+            "agent":    agent.Name,
+            "agent_id": agent.ID,
+        }))
+        json.NewEncoder(w).Encode(agent)
+        
+    default:
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// agentMetricsHandler serves GET /api/agents/{id}/metrics from
+// get-agent-metrics. Output that is JSON is also returned parsed.
+func (s *Server) agentMetricsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.Method != http.MethodGet {
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    agent, ok := s.agents.Get(r.PathValue("id"))
+    if !ok {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%v %q", ErrUnknownAgent, r.PathValue("id")))
+        return
+    }
+    
+    var output []byte
+    err := s.withWorker(r.Context(), func() (err error) {
+        output, err = s.call(r.Context(), "get-agent-metrics", "--agent-id", agent.ID)
+        return err
+    })
+    if errors.Is(err, ErrQueueFull) {
+        writeJSONError(w, http.StatusTooManyRequests, err.Error())
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusBadGateway, err.Error())
+        return
+    }
+    output = bytes.TrimSpace(output)
+    response := map[string]interface{}{
+        "agent_id": agent.ID,
+        "output":   string(output),
+    }
+    if json.Valid(output) {
+        response["metrics"] = json.RawMessage(output)
+    }
+    json.NewEncoder(w).Encode(response)
+}
+
+// agentMemoryHandler serves PUT (or POST) /api/agents/{id}/memory, writing
+// {"key", "value"} to the agent's memory with update-agent-memory. A value
+// that is not a string is stored as its JSON.
+func (s *Server) agentMemoryHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.Method != http.MethodPut && r.Method != http.MethodPost {
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    agent, ok := s.agents.Get(r.PathValue("id"))
+    if !ok {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%v %q", ErrUnknownAgent, r.PathValue("id")))
+        return
+    }
+    
+    var request struct {
+        Key   string          `json:"key"`
+        Value json.RawMessage `json:"value"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+        return
+    }
+    if !agentMemoryKeyPattern.MatchString(request.Key) {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid memory key %q (letters, digits, _, . and -)", request.Key))
+        return
+    }
+    if len(request.Value) == 0 {
+        writeJSONError(w, http.StatusBadRequest, "missing memory value")
+        return
+    }
+    value := string(request.Value)
+    var text string
+    if json.Unmarshal(request.Value, &text) == nil {
+        value = text
+    }
+    
+    err := s.withWorker(r.Context(), func() error {
+        _, err := s.call(r.Context(), "update-agent-memory", "--agent-id", agent.ID, "--key", request.Key, "--value", value)
+        return err
+    })
+    if errors.Is(err, ErrQueueFull) {
+        writeJSONError(w, http.StatusTooManyRequests, err.Error())
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusBadGateway, err.Error())
+        return
+    }
+    agent, err = s.agents.Remember(agent.ID, request.Key, value)
+    if errors.Is(err, ErrUnknownAgent) {
+        // Deleted while its memory was being written
+        writeJSONError(w, http.StatusNotFound, err.Error())
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    json.NewEncoder(w).Encode(agent)
+}
+
+// maxAgentTaskRetries bounds maxRetries on agent tasks
+const maxAgentTaskRetries = 10
+
+// Server-side retries of an agent task wait agentTaskBackoff, doubling with
+// each attempt up to agentTaskMaxBackoff. The wait is jittered so tasks
+// that failed together do not all retry together.
+const (
+    agentTaskBackoff    = 500 * time.Millisecond
+    agentTaskMaxBackoff = 10 * time.Second
+)
+
+// agentTasksHandler serves POST /api/agents/{id}/tasks, running a task on
+// an agent as a job. context, feedbackLoop and model each select their own
+// execute-agent-with-* function, so at most one may be set. maxRetries alone
+// uses execute-agent-with-retry; with one of the others the server retries
+// that function itself. The result counts the attempts made.
+func (s *Server) agentTasksHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.Method != http.MethodPost {
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    agent, ok := s.agents.Get(r.PathValue("id"))
+    if !ok {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%v %q", ErrUnknownAgent, r.PathValue("id")))
+        return
+    }
+    
+    var request struct {
+        Task         string `json:"task"`
+        Context      string `json:"context"`
+        FeedbackLoop string `json:"feedbackLoop"`
+        Model        string `json:"model"`
+        MaxRetries   *int   `json:"maxRetries"`
+        Priority     string `json:"priority"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+        return
+    }
+    if strings.TrimSpace(request.Task) == "" {
+        writeJSONError(w, http.StatusBadRequest, "missing task")
+        return
+    }
+    
+    function := "execute-agent"
+    flags := []string{"--agent-id", agent.ID, "--task", request.Task}
+    var selected []string
+    var value string
+    for _, option := range []struct{ name, value, function string }{
+        {"context", request.Context, "execute-agent-with-context"},
+        {"feedbackLoop", request.FeedbackLoop, "execute-agent-with-feedback"},
+        {"model", request.Model, "execute-agent-with-llm"},
+    } {
+        if option.value != "" {
+            function = option.function
+            flags = append(flags, "--"+kebabCase(option.name), option.value)
+            selected = append(selected, option.name)
+            value = option.value
+        }
+    }
+    if len(selected) > 1 {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s cannot be combined: each runs a different function", strings.Join(selected, " and ")))
+        return
+    }
+    retries := 0
+    if request.MaxRetries != nil {
+        if *request.MaxRetries < 0 || *request.MaxRetries > maxAgentTaskRetries {
+            writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("maxRetries must be between 0 and %d", maxAgentTaskRetries))
+            return
+        }
+        if len(selected) == 0 {
+            function = "execute-agent-with-retry"
+            flags = append(flags, "--max-retries", strconv.Itoa(*request.MaxRetries))
+        } else {
+            retries = *request.MaxRetries
+        }
+    }
+    
+    spec := JobSpec{
+        Kind: "agent-task",
+        Name: agent.Name,
+        Args: map[string]interface{}{
+            "agent_id": agent.ID,
+            "function": function,
+            "task":     request.Task,
+        },
+        Initiator: requestInitiator("http", r),
+        Priority:  request.Priority,
+    }
+    if len(selected) > 0 {
+        spec.Args[selected[0]] = value
+    }
+    if request.MaxRetries != nil {
+        spec.Args["maxRetries"] = *request.MaxRetries
+    }
+    s.startJob(w, r, spec, func(ctx context.Context) map[string]interface{} {
+        return s.runAgentTask(ctx, agent, function, flags, retries)
+    })
+}
+
+// runAgentTask calls function, trying again with backoff up to retries
+// times while it fails, and reports the output of the last attempt
+func (s *Server) runAgentTask(ctx context.Context, agent Agent, function string, flags []string, retries int) map[string]interface{} {
+    var output []byte
+    var err error
+    attempts := 0
+    for attempts <= retries {
+        if attempts > 0 && !sleepContext(ctx, agentTaskDelay(s.taskBackoff, attempts)) {
+            // Cancelled while waiting to try again
+            err = classifyDaggerError(ctx, function, s.timeouts.For(function), ctx.Err())
+            break
+        }
+        attempts++
+        output, err = s.call(ctx, function, flags...)
+        // A cancelled job or one out of time is not worth another attempt
+        if err == nil || ctx.Err() != nil {
+            break
+        }
+    }
+    
+    if function == "execute-agent-with-retry" && err == nil {
+        // The module retries internally; trust its count only when it
+        // reports one as JSON
+        var reported struct {
+            Attempts int `json:"attempts"`
+        }
+        if json.Unmarshal(bytes.TrimSpace(output), &reported) == nil && reported.Attempts > 0 {
+            attempts = reported.Attempts
+        }
+    }
+    
+    var result map[string]interface{}
+    if err != nil {
+        result = testFailure(err, fmt.Sprintf("Task on agent %s failed", agent.Name))
+    } else {
+        result = map[string]interface{}{
+            "success": true,
+            "status":  InvocationOK,
+            "output":  strings.TrimSpace(string(output)),
+        }
+    }
+    result["agent_id"] = agent.ID
+    result["function"] = function
+    result["attempts"] = attempts
+    return result
+}
+
+// agentTaskDelay is the jittered wait before retry n (from 1) of an agent
+// task whose first retry waits about base
+func agentTaskDelay(base time.Duration, n int) time.Duration {
+    delay := agentTaskMaxBackoff
+    if n < 16 {
+        delay = min(base<<(n-1), agentTaskMaxBackoff)
+    }
+    // Anywhere from half the delay to all of it
+    half := int64(delay / 2)
+    return time.Duration(half + rand.Int63n(half+1))
+}
+
+// sleepContext waits for d, reporting false if ctx ended first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return true
+    case <-ctx.Done():
+        return false
+    }
+}
+
+// ErrUnknownCommand is returned for a command that is not registered
+var ErrUnknownCommand = errors.New("unknown command")
+
+// prepareCommand resolves a command and validates its args, returning the
+// job to run. HTTP, the WebSocket and the CLI all go through it, so they
+// reject the same requests.
+func (s *Server) prepareCommand(name string, args map[string]interface{}) (JobSpec, func(ctx context.Context) map[string]interface{}, error) {
+    command := s.commands.Get(name)
+    if command == nil {
+        return JobSpec{}, nil, fmt.Errorf("%w %q", ErrUnknownCommand, name)
+    }
+    flags, err := command.Flags(args)
+    if err != nil {
+        return JobSpec{}, nil, err
+    }
+    
+    spec := JobSpec{
+        Kind: "command",
+        Name: command.Name,
+        Args: map[string]interface{}{"command": command.Name},
+    }
+    if len(args) > 0 {
+        spec.Args["args"] = args
+    }
+    return spec, func(ctx context.Context) map[string]interface{} {
+        return s.executeCommand(ctx, command, flags)
+    }, nil
+}
+
+// startJob submits a job and answers 202 with it, or with ?wait=true
+// blocks until it finishes and returns its result like the old synchronous
+// API. A full queue is a 429. It returns the job, or nil when it answered
+// with an error instead.
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request, spec JobSpec, fn func(ctx context.Context) map[string]interface{}) *Job {
+    switch spec.Priority {
+    case "", PriorityInteractive, PriorityBackground:
+    default:
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid priority %q (want interactive or background)", spec.Priority))
+        return nil
+    }
+    
+    job, err := s.jobs.Start(r.Context(), spec, fn)
+    if err != nil {
+        writeJSONError(w, http.StatusTooManyRequests, err.Error())
+        return nil
+    }
+    
+    if r.URL.Query().Get("wait") == "true" {
+        select {
+        case <-job.Done():
+            json.NewEncoder(w).Encode(job.View().Result)
+        case <-r.Context().Done():
+            // The caller gave up waiting, so nobody wants the result
+            s.jobs.Cancel(job.ID)
+        }
+        return job
+    }
+    
+    w.Header().Set("Location", "/api/jobs/"+job.ID)
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(job.View())
+    return job
+}
+
+// jobsHandler serves GET /api/jobs (optionally ?state=&kind=)
+func (s *Server) jobsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    query := r.URL.Query()
+    json.NewEncoder(w).Encode(s.jobs.List(query.Get("state"), query.Get("kind")))
+}
+
+// jobHandler serves GET /api/jobs/{id}, and cancels the job on DELETE
+// /api/jobs/{id} or POST /api/jobs/{id}/cancel
+func (s *Server) jobHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    job := s.jobs.Get(r.PathValue("id"))
+    if job == nil {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown job %q", r.PathValue("id")))
+        return
+    }
+    
+    cancelRoute := strings.HasSuffix(r.URL.Path, "/cancel")
+    switch {
+    case r.Method == http.MethodGet && !cancelRoute:
+    case r.Method == http.MethodDelete && !cancelRoute, r.Method == http.MethodPost && cancelRoute:
+        if !s.jobs.Cancel(job.ID) {
+            writeJSONError(w, http.StatusConflict, fmt.Sprintf("job %s already %s", job.ID, job.View().State))
+            return
+        }
+    default:
+        writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    json.NewEncoder(w).Encode(job.View())
+}
+
+// executeCommand runs a dashboard command with its validated flags and
+// publishes its outcome. It backs both POST /api/execute and the WebSocket
+// "execute" method.
+func (s *Server) executeCommand(ctx context.Context, command *Command, flags []string) map[string]interface{} {
+    var output string
+    var err error
+    if command.run != nil {
+        output, err = command.run(ctx, s, flags)
+    } else {
+        var result []byte
+        result, err = s.call(ctx, command.Function, flags...)
+        output = strings.TrimSpace(string(result))
+    }
+    
+    // Failures are reported as such, never papered over with canned output
+    status := invocationStatus(err)
+    if err != nil {
+        output = "Error: " + err.Error()
+    }
+    
+    s.events.Publish(NewEvent(EventCommandExecuted, map[string]interface{}{
+        "command": command.Name,
+        "status":  status,
+        "output":  output,
+    }))
+    
+    return map[string]interface{}{
+        "output":    output,
+        "status":    status,
+        "simulated": s.simulate,
+    }
+}
+
+// testFailure builds the /api/test response for a failed step, reporting
+// timeouts and cancellations explicitly instead of a generic message
+func testFailure(err error, message string) map[string]interface{} {
+    var assertErr *AssertionError
+    status := invocationStatus(err)
+    if status == InvocationTimedOut || status == InvocationCancelled || errors.As(err, &assertErr) {
+        message = fmt.Sprintf("%s: %v", message, err)
+    } else if tail := stderrTail(err); tail != "" {
+        message = fmt.Sprintf("%s: %s", message, tail)
+    }
+    return map[string]interface{}{
+        "success": false,
+        "status":  status,
+        "error":   message,
+    }
+}
+
+func (s *Server) testHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    var request struct {
+        Suite    string `json:"suite"`
+        Priority string `json:"priority"`
+    }
+    
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+        return
+    }
+    
+    suite := s.suites.Get(request.Suite)
+    if suite == nil {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unknown test suite: %s", request.Suite))
+        return
+    }
+    
+    spec := JobSpec{
+        Kind:      "test",
+        Name:      request.Suite,
+        Args:      map[string]interface{}{"suite": request.Suite},
+        Initiator: requestInitiator("http", r),
+        Priority:  request.Priority,
+    }
+    if spec.Priority == "" {
+        spec.Priority = suite.Priority
+    }
+    s.startJob(w, r, spec, func(ctx context.Context) map[string]interface{} {
+        return s.runTestSuite(ctx, suite)
+    })
+}
+
+// testSuitesHandler serves GET /api/test/suites
+func (s *Server) testSuitesHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(s.suites.All())
+}
+
+// jobLogsHandler serves GET /api/jobs/{id}/logs. By default it is an SSE
+// stream of `log` events (resumable by sequence number) that ends with an
+// `end` event once the job finishes; ?format=text downloads the retained
+// log and ?format=json returns it as an array.
+func (s *Server) jobLogsHandler(w http.ResponseWriter, r *http.Request) {
+    job := s.jobs.Get(r.PathValue("id"))
+    if job == nil {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown job %q", r.PathValue("id")))
+        return
+    }
+    
+    switch format := r.URL.Query().Get("format"); format {
+    case "text":
+        lines, _, _ := job.LogsAfter(0)
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.ID+".log"))
+        for _, line := range lines {
+            fmt.Fprintf(w, "%s %s %s | %s\n", line.Time, line.Function, line.Stream, line.Line)
+        }
+        return
+    case "json":
+        lines, _, _ := job.LogsAfter(0)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(lines)
+        return
+    case "", "sse":
+    default:
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q (want text, json or sse)", format))
+        return
+    }
+    
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+    
+    seq := 0
+    if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+        id, err := strconv.Atoi(lastID)
+        if err != nil {
+            http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+            return
+        }
+        seq = id
+    }
+    
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    fmt.Fprintf(w, "retry: %d\n\n", s.sseRetry.Milliseconds())
+    
+    heartbeat := time.NewTicker(s.sseHeartbeat)
+    defer heartbeat.Stop()
+    
+    for {
+        lines, more, finished := job.LogsAfter(seq)
+        for _, line := range lines {
+            data, _ := json.Marshal(line)
+            fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", line.Seq, data)
+            seq = line.Seq
+        }
+        if finished {
+            view := job.View()
+            data, _ := json.Marshal(map[string]interface{}{
+                "job_id":    job.ID,
+                "state":     view.State,
+                "exit_code": view.ExitCode,
+            })
+            fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+            flusher.Flush()
+            return
+        }
+        flusher.Flush()
+        
+        select {
+        case <-more:
+        case <-job.Done():
+        case <-heartbeat.C:
+            fmt.Fprintf(w, ": heartbeat %s\n\n", time.Now().Format(time.RFC3339))
+        case <-r.Context().Done():
+            return
+        }
+    }
+}
+
+// runsHandler serves GET /api/runs: stored run records, newest first,
+// filtered by suite, command, kind, status and from/to, paginated with
+// limit and offset
+func (s *Server) runsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    q, err := parseRunQuery(r.URL.Query())
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    json.NewEncoder(w).Encode(s.runs.Page(q))
+}
+
+// parseRunQuery builds a RunQuery from the /api/runs parameters, which
+// `proactiva runs list` accepts as flags
+func parseRunQuery(query url.Values) (RunQuery, error) {
+    q := RunQuery{
+        Kind:   query.Get("kind"),
+        Status: query.Get("status"),
+        Limit:  50,
+    }
+    switch suite, command := query.Get("suite"), query.Get("command"); {
+    case suite != "" && command != "":
+        return q, errors.New("suite and command are mutually exclusive")
+    case suite != "":
+        q.Kind, q.Name = "test", suite
+    case command != "":
+        q.Kind, q.Name = "command", command
+    }
+    
+    var err error
+    if q.From, err = parseTimeParam(query.Get("from"), time.Time{}); err != nil {
+        return q, fmt.Errorf("invalid from: %v", err)
+    }
+    if q.To, err = parseTimeParam(query.Get("to"), time.Time{}); err != nil {
+        return q, fmt.Errorf("invalid to: %v", err)
+    }
+    if v := query.Get("limit"); v != "" {
+        if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > 500 {
+            return q, fmt.Errorf("invalid limit: %q (1-500)", v)
+        }
+    }
+    if v := query.Get("offset"); v != "" {
+        if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+            return q, fmt.Errorf("invalid offset: %q", v)
+        }
+    }
+    return q, nil
+}
+
+// runHandler serves GET /api/runs/{id}
+func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
+    run, ok := s.runs.Get(r.PathValue("id"))
+    if !ok {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown run %q", r.PathValue("id")))
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(run)
+}
+
+// runReportHandler serves GET /api/runs/{id}/report?format=junit|tap
+func (s *Server) runReportHandler(w http.ResponseWriter, r *http.Request) {
+    run, ok := s.runs.Get(r.PathValue("id"))
+    if !ok {
+        writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown run %q", r.PathValue("id")))
+        return
+    }
+    if run.Kind != "test" {
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("run %s is a %s, only test runs have reports", run.ID, run.Kind))
+        return
+    }
+    
+    var err error
+    switch format := r.URL.Query().Get("format"); format {
+    case "", "junit":
+        w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+        err = writeJUnitReport(w, run)
+    case "tap":
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        err = writeTAPReport(w, run)
+    default:
+        writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q (want junit or tap)", format))
+        return
+    }
+    if err != nil {
+        log.Printf("report for %s failed: %v", run.ID, err)
+    }
+}
+
+// requestInitiator identifies who started a job, as transport:client-ip
+func requestInitiator(transport string, r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    return transport + ":" + host
+}
+
+// runTestSuite runs a test suite and publishes its start and finish. It
+// backs both POST /api/test and the WebSocket "test" method.
+func (s *Server) runTestSuite(ctx context.Context, suite *TestSuite) map[string]interface{} {
+    s.events.Publish(NewEvent(EventTestStarted, map[string]interface{}{
+        "suite": suite.Name,
+    }))
+    
+    if suite.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, time.Duration(suite.Timeout))
+        defer cancel()
+    }
+    
+    var steps []StepResult
+    result := map[string]interface{}{
+        "success": true,
+        "status":  InvocationOK,
+        "message": suite.Message,
+    }
+    for _, step := range suite.Steps {
+        message, details, err := s.runTestStep(ctx, step, false, &steps)
+        if err != nil {
+            result = testFailure(err, suite.FailureMessage)
+            break
+        }
+        if message != "" {
+            result["message"] = message
+        }
+        result["details"] = details
+    }
+    
+    passed, failed := 0, 0
+    for _, step := range steps {
+        for _, check := range step.Assertions {
+            if check.Passed {
+                passed++
+            } else {
+                failed++
+            }
+        }
+    }
+    result["steps"] = steps
+    result["assertions"] = map[string]int{"passed": passed, "failed": failed}
+    result["simulated"] = s.simulate
+    
+    s.events.Publish(NewEvent(EventTestFinished, map[string]interface{}{
+        "suite":   suite.Name,
+        "success": result["success"],
+        "status":  result["status"],
+    }))
+    return result
+}
+
+// runTestStep runs a step, falling back to its Fallback steps if it fails
+// for any reason other than the suite being cancelled or out of time. It
+// returns the message and details of whichever step succeeded last.
+func (s *Server) runTestStep(ctx context.Context, step TestStep, fallback bool, steps *[]StepResult) (string, string, error) {
+    start := time.Now()
+    output, err := s.callWithTimeout(ctx, time.Duration(step.Timeout), step.Function, step.Args...)
+    text := strings.TrimSpace(string(output))
+    
+    // Output is only worth checking once the call itself succeeded
+    var assertions []AssertionResult
+    if err == nil {
+        var failed []string
+        for i := range step.Expect {
+            check := step.Expect[i].Evaluate(text)
+            if !check.Passed {
+                failed = append(failed, check.Assertion)
+            }
+            assertions = append(assertions, check)
+        }
+        if len(failed) > 0 {
+            err = &AssertionError{Function: step.Function, Failed: failed}
+        }
+    }
+    
+    stepResult := StepResult{
+        Name:       step.Name,
+        Function:   step.Function,
+        Status:     invocationStatus(err),
+        DurationMS: time.Since(start).Milliseconds(),
+        Fallback:   fallback,
+        Assertions: assertions,
+    }
+    if err != nil {
+        stepResult.Error = err.Error()
+    }
+    *steps = append(*steps, stepResult)
+    
+    if err != nil {
+        if len(step.Fallback) == 0 || ctx.Err() != nil {
+            return "", "", err
+        }
+        var message, details string
+        for _, next := range step.Fallback {
+            if message, details, err = s.runTestStep(ctx, next, true, steps); err != nil {
+                return "", "", err
+            }
+        }
+        return message, details, nil
+    }
+    
+    details := text
+    if step.Details != "" {
+        details = strings.ReplaceAll(step.Details, "{output}", text)
+    }
+    return step.Message, details, nil
+}
+
+// promHandler serves /metrics in the Prometheus text exposition format
+func (s *Server) promHandler(w http.ResponseWriter, r *http.Request) {
+    var pw promWriter
+    pw.writeStatus(s.status.Get(r.Context()))
+    s.prom.writeCounters(&pw)
+    
+    running, queued := s.jobs.Stats()
+    pw.family("proactiva_jobs_running", "gauge", "Jobs currently holding a worker.")
+    pw.sample("proactiva_jobs_running", nil, float64(running))
+    pw.family("proactiva_jobs_queued", "gauge", "Jobs waiting for a worker by priority.")
+    for _, priority := range []string{PriorityBackground, PriorityInteractive} {
+        pw.sample("proactiva_jobs_queued", []string{"priority", priority}, float64(queued[priority]))
+    }
+    
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    io.WriteString(w, pw.b.String())
+}
+
+// websocketGUID is the fixed key suffix from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+    wsContinuation = 0x0
+    wsText         = 0x1
+    wsBinary       = 0x2
+    wsClose        = 0x8
+    wsPing         = 0x9
+    wsPong         = 0xA
+)
+
+// wsMaxMessage bounds a reassembled client message
+const wsMaxMessage = 1 << 20
+
+// wsConn is a minimal RFC 6455 server connection: enough for the JSON
+// control channel (text frames, fragmentation, ping/pong and close)
+type wsConn struct {
+    conn    net.Conn
+    reader  *bufio.Reader
+    writeMu sync.Mutex
+}
+
+// upgradeWebSocket performs the opening handshake and takes over the
+// connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+    if r.Method != http.MethodGet ||
+        !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+        !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+        return nil, errors.New("not a websocket handshake")
+    }
+    if r.Header.Get("Sec-WebSocket-Version") != "13" {
+        return nil, errors.New("unsupported websocket version")
+    }
+    key := r.Header.Get("Sec-WebSocket-Key")
+    if key == "" {
+        return nil, errors.New("missing Sec-WebSocket-Key")
+    }
+    
+    conn, rw, err := http.NewResponseController(w).Hijack()
+    if err != nil {
+        return nil, err
+    }
+    
+    digest := sha1.Sum([]byte(key + websocketGUID))
+    fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+        "Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+        base64.StdEncoding.EncodeToString(digest[:]))
+    if err := rw.Flush(); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// ReadMessage returns the next complete data message, answering pings and
+// close frames along the way. A close from the client returns io.EOF.
+func (c *wsConn) ReadMessage() (opcode byte, payload []byte, err error) {
+    var message []byte
+    var messageOp byte
+    
+    for {
+        header := make([]byte, 2)
+        if _, err := io.ReadFull(c.reader, header); err != nil {
+            return 0, nil, err
+        }
+        fin := header[0]&0x80 != 0
+        op := header[0] & 0x0F
+        masked := header[1]&0x80 != 0
+        length := uint64(header[1] & 0x7F)
+        
+        switch length {
+        case 126:
+            ext := make([]byte, 2)
+            if _, err := io.ReadFull(c.reader, ext); err != nil {
+                return 0, nil, err
+            }
+            length = uint64(binary.BigEndian.Uint16(ext))
+        case 127:
+            ext := make([]byte, 8)
+            if _, err := io.ReadFull(c.reader, ext); err != nil {
+                return 0, nil, err
+            }
+            length = binary.BigEndian.Uint64(ext)
+        }
+        if !masked {
+            return 0, nil, errors.New("client frames must be masked")
+        }
+        if length > wsMaxMessage || uint64(len(message))+length > wsMaxMessage {
+            c.WriteMessage(wsClose, closePayload(1009, "message too big"))
+            return 0, nil, errors.New("websocket message too big")
+        }
+        
+        var mask [4]byte
+        if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+            return 0, nil, err
+        }
+        data := make([]byte, length)
+        if _, err := io.ReadFull(c.reader, data); err != nil {
+            return 0, nil, err
+        }
+        for i := range data {
+            data[i] ^= mask[i%4]
+        }
+        
+        switch op {
+        case wsPing:
+            c.WriteMessage(wsPong, data)
+            continue
+        case wsPong:
+            continue
+        case wsClose:
+            c.WriteMessage(wsClose, data)
+            return 0, nil, io.EOF
+        case wsContinuation:
+            if messageOp == 0 {
+                c.WriteMessage(wsClose, closePayload(1002, "unexpected continuation frame"))
+                return 0, nil, errors.New("unexpected continuation frame")
+            }
+        case wsText, wsBinary:
+            // RFC 6455 5.4: a fragmented message is only continued, never
+            // interleaved with another data message
+            if messageOp != 0 {
+                c.WriteMessage(wsClose, closePayload(1002, "data frame inside a fragmented message"))
+                return 0, nil, errors.New("data frame inside a fragmented message")
+            }
+            messageOp = op
+        default:
+            c.WriteMessage(wsClose, closePayload(1002, "unknown opcode"))
+            return 0, nil, fmt.Errorf("unknown websocket opcode %#x", op)
+        }
+        
+        message = append(message, data...)
+        if fin {
+            return messageOp, message, nil
+        }
+    }
+}
+
+// WriteMessage sends one unfragmented, unmasked frame
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+    header := []byte{0x80 | opcode}
+    switch n := len(payload); {
+    case n < 126:
+        header = append(header, byte(n))
+    case n <= 0xFFFF:
+        header = append(header, 126, byte(n>>8), byte(n))
+    default:
+        header = append(header, 127)
+        header = binary.BigEndian.AppendUint64(header, uint64(n))
+    }
+    
+    c.writeMu.Lock()
+    defer c.writeMu.Unlock()
+    c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+    if _, err := c.conn.Write(header); err != nil {
+        return err
+    }
+    _, err := c.conn.Write(payload)
+    return err
+}
+
+func (c *wsConn) Close() error {
+    return c.conn.Close()
+}
+
+func closePayload(code uint16, reason string) []byte {
+    return append(binary.BigEndian.AppendUint16(nil, code), reason...)
+}
+
+// wsRequest is a client message on /api/ws:
+// {"id": "1", "method": "test", "params": {"suite": "quick"}}
+type wsRequest struct {
+    ID     string          `json:"id"`
+    Method string          `json:"method"`
+    Params json.RawMessage `json:"params"`
+}
+
+// wsMessage is a server message on /api/ws. Type is "result", "progress",
+// "error" or "event"; replies carry the ID of the request they answer.
+type wsMessage struct {
+    ID       string      `json:"id,omitempty"`
+    Type     string      `json:"type"`
+    Result   interface{} `json:"result,omitempty"`
+    Progress interface{} `json:"progress,omitempty"`
+    Event    *Event      `json:"event,omitempty"`
+    Error    *wsError    `json:"error,omitempty"`
+}
+
+type wsError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+// JSON-RPC error codes used on the control channel
+const (
+    wsParseError     = -32700
+    wsInvalidRequest = -32600
+    wsMethodNotFound = -32601
+    wsInvalidParams  = -32602
+    wsServerBusy     = -32000
+)
+
+// wsSession is one control channel connection
+type wsSession struct {
+    server    *Server
+    conn      *wsConn
+    ctx       context.Context
+    initiator string
+    
+    mu       sync.Mutex
+    inflight map[string]context.CancelFunc
+    sub      *Subscription
+}
+
+func (ws *wsSession) send(msg wsMessage) {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        return
+    }
+    ws.conn.WriteMessage(wsText, data)
+}
+
+func (ws *wsSession) sendError(id string, code int, message string) {
+    ws.send(wsMessage{ID: id, Type: "error", Error: &wsError{Code: code, Message: message}})
+}
+
+// wsHandler serves the WebSocket control channel. Methods: subscribe
+// {topics, agent}, unsubscribe, status, execute {command}, test {suite}
+// and cancel {id}. Commands and tests run the same code as the REST routes.
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+    // Browsers let any page open a WebSocket to localhost, and CORS does
+    // not apply, so only the dashboard's own origin may drive the server
+    if !s.allowedOrigin(r) {
+        http.Error(w, "origin not allowed", http.StatusForbidden)
+        return
+    }
+    conn, err := upgradeWebSocket(w, r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    defer conn.Close()
+    
+    ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+    defer cancel()
+    
+    ws := &wsSession{
+        server:    s,
+        conn:      conn,
+        ctx:       ctx,
+        initiator: requestInitiator("ws", r),
+        inflight:  make(map[string]context.CancelFunc),
+    }
+    defer ws.unsubscribe()
+    
+    // Pings keep intermediaries from timing out an idle channel
+    go func() {
+        ticker := time.NewTicker(s.sseHeartbeat)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                conn.WriteMessage(wsPing, nil)
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    
+    for {
+        opcode, payload, err := conn.ReadMessage()
+        if err != nil {
+            return
+        }
+        if opcode != wsText {
+            ws.sendError("", wsInvalidRequest, "only text messages are supported")
+            continue
+        }
+        
+        var req wsRequest
+        if err := json.Unmarshal(payload, &req); err != nil {
+            ws.sendError("", wsParseError, err.Error())
+            continue
+        }
+        ws.dispatch(req)
+    }
+}
+
+func (ws *wsSession) dispatch(req wsRequest) {
+    if req.ID == "" {
+        ws.sendError("", wsInvalidRequest, "id is required")
+        return
+    }
+    
+    switch req.Method {
+    case "subscribe":
+        var params struct {
+            Topics []string `json:"topics"`
+            Agent  string   `json:"agent"`
+        }
+        if len(req.Params) > 0 && json.Unmarshal(req.Params, &params) != nil {
+            ws.sendError(req.ID, wsInvalidParams, "params must be {topics, agent}")
+            return
+        }
+        query := url.Values{}
+        if len(params.Topics) > 0 {
+            query.Set("topics", strings.Join(params.Topics, ","))
+        }
+        query.Set("agent", params.Agent)
+        filter, err := ParseEventFilter(query)
+        if err != nil {
+            ws.sendError(req.ID, wsInvalidParams, err.Error())
+            return
+        }
+        ws.subscribe(filter)
+        ws.send(wsMessage{ID: req.ID, Type: "result", Result: map[string]bool{"subscribed": true}})
+        
+    case "unsubscribe":
+        ws.unsubscribe()
+        ws.send(wsMessage{ID: req.ID, Type: "result", Result: map[string]bool{"subscribed": false}})
+        
+    case "status":
+        ws.send(wsMessage{ID: req.ID, Type: "result", Result: ws.server.status.Get(ws.ctx)})
+        
+    case "execute":
+        var params struct {
+            Command string                 `json:"command"`
+            Args    map[string]interface{} `json:"args"`
+        }
+        if json.Unmarshal(req.Params, &params) != nil || params.Command == "" {
+            ws.sendError(req.ID, wsInvalidParams, "params must be {command, args}")
+            return
+        }
+        spec, run, err := ws.server.prepareCommand(params.Command, params.Args)
+        if err != nil {
+            ws.sendError(req.ID, wsInvalidParams, err.Error())
+            return
+        }
+        ws.start(req.ID, spec, run)
+        
+    case "test":
+        var params struct {
+            Suite string `json:"suite"`
+        }
+        if json.Unmarshal(req.Params, &params) != nil || params.Suite == "" {
+            ws.sendError(req.ID, wsInvalidParams, "params must be {suite}")
+            return
+        }
+        suite := ws.server.suites.Get(params.Suite)
+        if suite == nil {
+            ws.sendError(req.ID, wsInvalidParams, fmt.Sprintf("Unknown test suite: %s", params.Suite))
+            return
+        }
+        spec := JobSpec{
+            Kind:     "test",
+            Name:     params.Suite,
+            Args:     map[string]interface{}{"suite": params.Suite},
+            Priority: suite.Priority,
+        }
+        ws.start(req.ID, spec, func(ctx context.Context) map[string]interface{} {
+            return ws.server.runTestSuite(ctx, suite)
+        })
+        
+    case "cancel":
+        var params struct {
+            ID string `json:"id"`
+        }
+        if json.Unmarshal(req.Params, &params) != nil || params.ID == "" {
+            ws.sendError(req.ID, wsInvalidParams, "params must be {id}")
+            return
+        }
+        ws.mu.Lock()
+        cancel, ok := ws.inflight[params.ID]
+        ws.mu.Unlock()
+        if !ok {
+            ws.sendError(req.ID, wsInvalidParams, fmt.Sprintf("no operation %q in flight", params.ID))
+            return
+        }
+        cancel()
+        ws.send(wsMessage{ID: req.ID, Type: "result", Result: map[string]bool{"cancelled": true}})
+        
+    default:
+        ws.sendError(req.ID, wsMethodNotFound, fmt.Sprintf("unknown method %q", req.Method))
+    }
+}
+
+// start runs op as a job registered under the request ID so it can be
+// cancelled. Its state changes and log lines arrive as progress messages,
+// then the result.
+func (ws *wsSession) start(id string, spec JobSpec, op func(ctx context.Context) map[string]interface{}) {
+    ws.mu.Lock()
+    if _, exists := ws.inflight[id]; exists {
+        ws.mu.Unlock()
+        ws.sendError(id, wsInvalidRequest, fmt.Sprintf("operation %q is already in flight", id))
+        return
+    }
+    spec.Initiator = ws.initiator
+    job, err := ws.server.jobs.Start(ws.ctx, spec, op)
+    if err != nil {
+        ws.mu.Unlock()
+        ws.sendError(id, wsServerBusy, err.Error())
+        return
+    }
+    ws.inflight[id] = func() { ws.server.jobs.Cancel(job.ID) }
+    ws.mu.Unlock()
+    
+    go func() {
+        defer func() {
+            ws.mu.Lock()
+            delete(ws.inflight, id)
+            ws.mu.Unlock()
+        }()
+        if !ws.follow(id, job) {
+            return
+        }
+        ws.send(wsMessage{ID: id, Type: "result", Result: job.View().Result})
+    }()
+}
+
+// follow sends a job's state changes and log lines as progress messages
+// for request id until the job finishes. It reports false if the session
+// closed first.
+func (ws *wsSession) follow(id string, job *Job) bool {
+    seq := 0
+    state, position := "", -1
+    for {
+        lines, more, finished := job.LogsAfter(seq)
+        for _, line := range lines {
+            ws.send(wsMessage{ID: id, Type: "progress", Progress: map[string]interface{}{
+                "job_id": job.ID,
+                "log":    line,
+            }})
+            seq = line.Seq
+        }
+        if finished {
+            return true
+        }
+        
+        // The final state arrives with the result
+        job.mu.Lock()
+        changed := job.state != state || job.position != position
+        state, position = job.state, job.position
+        job.mu.Unlock()
+        if changed && (state == JobQueued || state == JobRunning) {
+            progress := map[string]interface{}{"job_id": job.ID, "state": state}
+            if position > 0 {
+                progress["queue_position"] = position
+            }
+            ws.send(wsMessage{ID: id, Type: "progress", Progress: progress})
+        }
+        
+        select {
+        case <-more:
+        case <-job.Done():
+        case <-ws.ctx.Done():
+            return false
+        }
+    }
+}
+
+// subscribe replaces the session's event subscription
+func (ws *wsSession) subscribe(filter EventFilter) {
+    ws.unsubscribe()
+    
+    sub := ws.server.events.Subscribe(filter)
+    ws.mu.Lock()
+    ws.sub = sub
+    ws.mu.Unlock()
+    
+    go func() {
+        for event := range sub.C {
+            event := event
+            ws.send(wsMessage{Type: "event", Event: &event})
         }
-        
-        next(w, r)
+        // Dropped as a slow consumer rather than unsubscribed by the client
+        ws.mu.Lock()
+        dropped := ws.sub == sub
+        ws.mu.Unlock()
+        if dropped && ws.ctx.Err() == nil {
+            ws.sendError("", wsInvalidRequest, "subscription dropped: client too slow; subscribe again")
+        }
+    }()
+}
+
+func (ws *wsSession) unsubscribe() {
+    ws.mu.Lock()
+    sub := ws.sub
+    ws.sub = nil
+    ws.mu.Unlock()
+    if sub != nil {
+        ws.server.events.Unsubscribe(sub)
     }
 }
 
-// Check if Dagger is running and get real function count
-func getDaggerStatus() (bool, int) {
-    cmd := exec.Command("dagger", "functions")
-    output, err := cmd.Output()
-    if err != nil {
-        return false, 0
+// invocationsHandler exposes the calls recorded by the fake runner so
+// integration scripts can assert what the dashboard invoked
+func (s *Server) invocationsHandler(w http.ResponseWriter, r *http.Request) {
+    fake, ok := s.runner.(*FakeRunner)
+    if !ok {
+        http.Error(w, "Invocation recording requires PROACTIVA_DAGGER_RUNNER=fake", http.StatusNotFound)
+        return
     }
     
-    // Count lines that start with spaces (actual functions)
-    lines := strings.Split(string(output), "\n")
-    count := 0
-    for _, line := range lines {
-        if strings.HasPrefix(line, "  ") && strings.TrimSpace(line) != "" {
-            count++
-        }
+    if r.Method == http.MethodDelete {
+        fake.Reset()
+        w.WriteHeader(http.StatusNoContent)
+        return
     }
     
-    return true, count
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(fake.Invocations())
 }
 
-// Try to get real system status from Dagger
-func getRealSystemStatus() SystemStatus {
-    isConnected, functionCount := getDaggerStatus()
+// Exit codes of the CLI subcommands. Timeouts and cancellations use the
+// codes timeout(1) and an interrupted shell report.
+const (
+    exitOK        = 0
+    exitFailed    = 1
+    exitUsage     = 2
+    exitTimedOut  = 124
+    exitCancelled = 130
+)
+
+const cliUsage = `Usage: proactiva [command] [flags]
+
+Commands:
+  serve            run the web dashboard and API (default)
+  status           print the system status
+  test <suite>     run a test suite
+  exec <command>   run a dashboard command
+  runs list        list recorded runs
+
+Run "proactiva <command> -h" for the flags of a command.
+`
+
+func main() {
+    cfg, err := loadServerConfig()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Failed to load configuration:", err)
+        os.Exit(exitUsage)
+    }
     
-    status := SystemStatus{
-        Timestamp:       time.Now().Format(time.RFC3339),
-        Status:          "DISCONNECTED",
-        Agents:          0,
-        Generation:      1,
-        FitnessScore:    0.0,
-        SuccessRate:     0.0,
-        TotalFunctions:  0,
-        ActiveWorkflows: 0,
-        MemoryUsageMB:   0.0,
-        Components:      make(map[string]Component),
+    // Without a command the binary serves, as it always has
+    command, args := "serve", os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        command, args = args[0], args[1:]
     }
     
-    if isConnected {
-        status.Status = "CONNECTED"
-        status.TotalFunctions = functionCount
-        
-        // Try to get real status from Dagger
-        cmd := exec.Command("dagger", "call", "get-system-status")
-        output, err := cmd.Output()
-        if err == nil {
-            // Parse the output if successful
-            lines := strings.Split(string(output), "\n")
-            for _, line := range lines {
-                if strings.Contains(line, "agents:") {
-                    fmt.Sscanf(line, "agents: %d", &status.Agents)
-                } else if strings.Contains(line, "success_rate:") {
-                    fmt.Sscanf(line, "success_rate: %f", &status.SuccessRate)
-                } else if strings.Contains(line, "fitness:") {
-                    fmt.Sscanf(line, "fitness: %f", &status.FitnessScore)
-                }
-            }
-        }
-        
-        // If we couldn't get real data, provide realistic defaults for connected state
-        if status.Agents == 0 {
-            status.Agents = 5
-            status.FitnessScore = 0.875
-            status.SuccessRate = 0.92
-            status.ActiveWorkflows = 3
-            status.MemoryUsageMB = 123.5
+    code := exitOK
+    switch command {
+    case "serve":
+        code = cliServe(cfg, args)
+    case "status":
+        code = cliStatus(cfg, args)
+    case "test":
+        code = cliTest(cfg, args)
+    case "exec":
+        code = cliExec(cfg, args)
+    case "runs":
+        code = cliRuns(cfg, args)
+    case "help":
+        fmt.Print(cliUsage)
+    default:
+        fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, cliUsage)
+        code = exitUsage
+    }
+    os.Exit(code)
+}
+
+// cliCommand holds the flags every subcommand shares
+type cliCommand struct {
+    name    string
+    flags   *flag.FlagSet
+    cfg     *ServerConfig
+    format  string
+    formats []string
+}
+
+// newCLICommand sets up a subcommand's flags. The first of formats, if
+// any, is the default --format.
+func newCLICommand(name, usage string, cfg *ServerConfig, formats ...string) *cliCommand {
+    c := &cliCommand{
+        name:    name,
+        flags:   flag.NewFlagSet(name, flag.ContinueOnError),
+        cfg:     cfg,
+        formats: formats,
+    }
+    c.flags.Usage = func() {
+        fmt.Fprintf(c.flags.Output(), "Usage: proactiva %s\n\nFlags:\n", usage)
+        c.flags.PrintDefaults()
+    }
+    c.flags.BoolVar(&cfg.Simulate, "simulate", cfg.Simulate, "serve clearly labelled synthetic data instead of calling Dagger")
+    if len(formats) > 0 {
+        c.flags.StringVar(&c.format, "format", formats[0], "output format: "+strings.Join(formats, ", "))
+    }
+    return c
+}
+
+// parse parses args, which may mix flags and positional arguments, and
+// returns exactly nargs positional arguments
+func (c *cliCommand) parse(args []string, nargs int) ([]string, error) {
+    var positional []string
+    for {
+        if err := c.flags.Parse(args); err != nil {
+            return nil, err
         }
-        
-        // Set component status
-        status.Components = map[string]Component{
-            "collective_intelligence": {Status: "active", SizeMB: 45.2},
-            "a2a_communication":       {Status: "active", SizeMB: 23.8},
-            "learning_system":         {Status: "active", SizeMB: 31.5},
-            "agent_orchestration":     {Status: "active", SizeMB: 22.9},
+        if args = c.flags.Args(); len(args) == 0 {
+            break
         }
+        positional, args = append(positional, args[0]), args[1:]
     }
     
-    return status
+    if len(positional) != nargs {
+        return nil, c.usageError("expected %d argument(s), got %d", nargs, len(positional))
+    }
+    if len(c.formats) > 0 && !slices.Contains(c.formats, c.format) {
+        return nil, c.usageError("invalid format %q (want %s)", c.format, strings.Join(c.formats, ", "))
+    }
+    return positional, nil
 }
 
-func statusHandler(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    status := getRealSystemStatus()
-    json.NewEncoder(w).Encode(status)
+// usageError reports a bad invocation along with the usage
+func (c *cliCommand) usageError(format string, a ...interface{}) error {
+    err := fmt.Errorf(format, a...)
+    fmt.Fprintf(c.flags.Output(), "proactiva %s: %v\n", c.name, err)
+    c.flags.Usage()
+    return err
 }
 
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    
-    metrics := []MetricsData{}
-    now := time.Now()
-    
-    // Generate realistic trend data
-    for i := 59; i >= 0; i-- {
-        t := now.Add(-time.Duration(i) * time.Minute)
-        metrics = append(metrics, MetricsData{
-            Timestamp:   t.Format(time.RFC3339),
-            SuccessRate: 0.7 + float64(60-i)*0.003 + rand.Float64()*0.05,
-            Fitness:     0.5 + float64(60-i)*0.005 + rand.Float64()*0.02,
-            TaskCount:   3 + (60-i)/10 + rand.Intn(3),
-            MemoryMB:    40 + float64(60-i)*0.1 + rand.Float64()*5,
-        })
+// exitCode maps a parse error to an exit code. The problem has already
+// been printed; asking for help is not a failure.
+func (c *cliCommand) exitCode(err error) int {
+    if errors.Is(err, flag.ErrHelp) {
+        return exitOK
+    }
+    return exitUsage
+}
+
+// server builds the Server core that serve runs. Only serve calls
+// startServing, so subcommands never touch the event log, record status
+// samples or compact stores a running server shares with them.
+func (c *cliCommand) server() (*Server, error) {
+    runner, err := newRunner(*c.cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to configure Dagger runner: %w", err)
+    }
+    return NewServer(runner, *c.cfg)
+}
+
+// writeJSON prints v as indented JSON
+func (c *cliCommand) writeJSON(v interface{}) {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    enc.Encode(v)
+}
+
+// routes returns a mux serving the API and /metrics; each API handler is
+// wrapped with CORS, tracing and request metrics
+func (s *Server) routes() *http.ServeMux {
+    mux := http.NewServeMux()
+    route := func(pattern string, handler http.HandlerFunc) {
+        mux.HandleFunc(pattern, s.prom.Instrument(pattern, s.tracer.Trace(pattern, s.cors(handler))))
     }
     
-    json.NewEncoder(w).Encode(metrics)
+    route("/api/status", s.statusHandler)
+    route("/api/metrics", s.metricsHandler)
+    route("/api/events", s.eventsHandler)
+    route("/api/execute", s.executeHandler)
+    route("/api/commands", s.commandsHandler)
+    route("/api/functions", s.functionsHandler)
+    route("/api/functions/{name}", s.functionHandler)
+    route("/api/test", s.testHandler)
+    route("/api/test/suites", s.testSuitesHandler)
+    route("/api/runner/invocations", s.invocationsHandler)
+    route("/api/ws", s.wsHandler)
+    route("/api/jobs", s.jobsHandler)
+    route("/api/jobs/{id}", s.jobHandler)
+    route("/api/jobs/{id}/cancel", s.jobHandler)
+    route("/api/jobs/{id}/logs", s.jobLogsHandler)
+    route("/api/runs", s.runsHandler)
+    route("/api/runs/{id}", s.runHandler)
+    route("/api/runs/{id}/report", s.runReportHandler)
+    route("/api/agents", s.agentsHandler)
+    route("/api/agents/types", s.agentTypesHandler)
+    route("/api/agents/{id}", s.agentHandler)
+    route("/api/agents/{id}/metrics", s.agentMetricsHandler)
+    route("/api/agents/{id}/memory", s.agentMemoryHandler)
+    route("/api/agents/{id}/tasks", s.agentTasksHandler)
+    mux.HandleFunc("/metrics", s.promHandler)
+    return mux
 }
 
-func eventsHandler(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "text/event-stream")
-    w.Header().Set("Cache-Control", "no-cache")
-    w.Header().Set("Connection", "keep-alive")
+// cliServe runs the web dashboard and API
+func cliServe(cfg ServerConfig, args []string) int {
+    c := newCLICommand("serve", "serve [flags]", &cfg)
+    addr := ":8080"
+    if port := os.Getenv("PORT"); port != "" {
+        addr = ":" + port
+    }
+    c.flags.StringVar(&addr, "addr", addr, "listen address (default from PORT)")
+    if _, err := c.parse(args, 0); err != nil {
+        return c.exitCode(err)
+    }
+    _, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        return c.exitCode(c.usageError("invalid address %q: %v", addr, err))
+    }
     
-    flusher, ok := w.(http.Flusher)
-    if !ok {
-        http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
-        return
+    // Read dashboard HTML
+    dashboardPath := "dashboard.html"
+    if _, err := os.Stat("/app/dashboard.html"); err == nil {
+        dashboardPath = "/app/dashboard.html"
     }
     
-    // Send initial connection event
-    event := map[string]interface{}{
-        "event":       "system_connected",
-        "timestamp":   time.Now().Format(time.RFC3339),
-        "success_rate": 0.92,
-        "memory_mb":   123.5,
+    dashboardHTML, err := os.ReadFile(dashboardPath)
+    if err != nil {
+        log.Println("Failed to read dashboard HTML:", err)
+        return exitFailed
     }
     
-    data, _ := json.Marshal(event)
-    fmt.Fprintf(w, "data: %s\n\n", data)
-    flusher.Flush()
+    server, err := c.server()
+    if err != nil {
+        log.Println(err)
+        return exitFailed
+    }
+    if err := server.startServing(context.Background(), cfg); err != nil {
+        log.Println(err)
+        return exitFailed
+    }
     
-    // Keep connection alive with periodic events
-    ticker := time.NewTicker(5 * time.Second)
-    defer ticker.Stop()
+    // Routes
+    mux := server.routes()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html")
+        w.Write(dashboardHTML)
+    })
     
-    for {
-        select {
-        case <-ticker.C:
-            status := getRealSystemStatus()
-            event := map[string]interface{}{
-                "event":        "status_update",
-                "timestamp":    time.Now().Format(time.RFC3339),
-                "success_rate": status.SuccessRate,
-                "memory_mb":    status.MemoryUsageMB,
-                "agents":       status.Agents,
-                "connected":    status.Status == "CONNECTED",
-            }
-            
-            data, _ := json.Marshal(event)
-            fmt.Fprintf(w, "data: %s\n\n", data)
-            flusher.Flush()
-            
-        case <-r.Context().Done():
-            return
-        }
+    fmt.Println("🌐 ProactivaDev Web Management Interface starting on port " + port)
+    fmt.Println("📊 Dashboard: http://localhost:" + port)
+    fmt.Println("🔌 API: http://localhost:" + port + "/api/status")
+    fmt.Println("📈 SSE: http://localhost:" + port + "/api/events")
+    fmt.Println("📏 Prometheus: http://localhost:" + port + "/metrics")
+    if cfg.Simulate {
+        fmt.Println("⚠️  SIMULATION MODE: all data is synthetic (--simulate / PROACTIVA_SIMULATE)")
+    }
+    if _, ok := server.runner.(*FakeRunner); ok {
+        fmt.Println("🧪 Using fake Dagger runner (PROACTIVA_DAGGER_RUNNER=fake)")
+    }
+    
+    if err := http.ListenAndServe(addr, mux); err != nil {
+        log.Println(err)
+        return exitFailed
     }
+    return exitOK
 }
 
-func executeHandler(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    
-    var request struct {
-        Command string `json:"command"`
+// cliStatus prints the system status, exiting non-zero when Dagger is
+// unreachable
+func cliStatus(cfg ServerConfig, args []string) int {
+    c := newCLICommand("status", "status [flags]", &cfg, "text", "json")
+    if _, err := c.parse(args, 0); err != nil {
+        return c.exitCode(err)
     }
-    
-    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-        json.NewEncoder(w).Encode(map[string]string{
-            "output": "Error: Invalid request",
-        })
-        return
+    server, err := c.server()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
     }
     
-    var output string
-    switch request.Command {
-    case "initialize":
-        // Try to actually initialize the system
-        cmd := exec.Command("dagger", "call", "test-connection")
-        result, err := cmd.Output()
-        if err != nil {
-            output = "Initialized system (simulation mode)"
-        } else {
-            output = strings.TrimSpace(string(result))
-        }
-        
-    case "test":
-        cmd := exec.Command("dagger", "functions")
-        result, err := cmd.Output()
-        if err != nil {
-            output = "Tests completed successfully (simulation)"
-        } else {
-            lines := strings.Split(string(result), "\n")
-            output = fmt.Sprintf("System operational - %d functions available", len(lines)-1)
+    status := server.status.Refresh(context.Background())
+    if c.format == "json" {
+        c.writeJSON(status)
+    } else {
+        printStatus(os.Stdout, status)
+    }
+    if status.Status != "CONNECTED" && status.Status != "SIMULATED" {
+        return exitFailed
+    }
+    return exitOK
+}
+
+// printStatus writes a status as text. Fields with no known source are
+// shown as unknown rather than as their zero value.
+func printStatus(w io.Writer, status SystemStatus) {
+    tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+    fmt.Fprintf(tw, "Status:\t%s\n", status.Status)
+    field := func(label, key string, value interface{}) {
+        source := status.Sources[key]
+        if source == "" || source == SourceUnknown {
+            fmt.Fprintf(tw, "%s:\tunknown\n", label)
+            return
         }
-        
-    case "evolve":
-        output = "Evolution triggered - fitness improving"
-        
-    case "export":
-        output = "Knowledge exported to knowledge_base.json"
-        
-    default:
-        output = fmt.Sprintf("Command '%s' executed", request.Command)
+        fmt.Fprintf(tw, "%s:\t%v\t(%s)\n", label, value, source)
     }
-    
-    json.NewEncoder(w).Encode(map[string]string{
-        "output": output,
-    })
+    field("Agents", "agents", status.Agents)
+    field("Generation", "generation", status.Generation)
+    field("Fitness score", "fitness_score", fmt.Sprintf("%.3f", status.FitnessScore))
+    field("Success rate", "success_rate", fmt.Sprintf("%.1f%%", status.SuccessRate*100))
+    field("Functions", "total_functions", status.TotalFunctions)
+    field("Active workflows", "active_workflows", status.ActiveWorkflows)
+    field("Memory", "memory_usage_mb", fmt.Sprintf("%.1f MB", status.MemoryUsageMB))
+    field("Components", "components", len(status.Components))
+    names := make([]string, 0, len(status.Components))
+    for name := range status.Components {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        component := status.Components[name]
+        fmt.Fprintf(tw, "  %s:\t%s\t%.1f MB\n", name, component.Status, component.SizeMB)
+    }
+    if status.Error != "" {
+        fmt.Fprintf(tw, "Error:\t%s\n", status.Error)
+    }
+    tw.Flush()
 }
 
-func testHandler(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    
-    var request struct {
-        Suite string `json:"suite"`
+// cliTest runs a test suite as a job, exactly as POST /api/test does
+func cliTest(cfg ServerConfig, args []string) int {
+    c := newCLICommand("test", "test <suite> [flags]", &cfg, "text", "json", "junit", "tap")
+    verbose := c.flags.Bool("v", false, "stream the Dagger output to stderr while the suite runs")
+    positional, err := c.parse(args, 1)
+    if err != nil {
+        return c.exitCode(err)
+    }
+    server, err := c.server()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
     }
     
-    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-        json.NewEncoder(w).Encode(map[string]interface{}{
-            "success": false,
-            "error": "Invalid request",
-        })
-        return
+    suite := server.suites.Get(positional[0])
+    if suite == nil {
+        var names []string
+        for _, s := range server.suites.All() {
+            names = append(names, s.Name)
+        }
+        return c.exitCode(c.usageError("Unknown test suite: %s (available: %s)", positional[0], strings.Join(names, ", ")))
     }
     
-    var result map[string]interface{}
+    spec := JobSpec{
+        Kind:      "test",
+        Name:      suite.Name,
+        Args:      map[string]interface{}{"suite": suite.Name},
+        Initiator: "cli",
+        Priority:  suite.Priority,
+    }
+    run, err := runCLIJob(server, spec, *verbose, func(ctx context.Context) map[string]interface{} {
+        return server.runTestSuite(ctx, suite)
+    })
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
+    }
     
-    switch request.Suite {
-    case "quick":
-        // Quick connection test
-        cmd := exec.Command("dagger", "call", "test-connection")
-        output, err := cmd.Output()
-        if err != nil {
-            result = map[string]interface{}{
-                "success": false,
-                "error": "Connection failed",
-            }
-        } else {
-            result = map[string]interface{}{
-                "success": true,
-                "message": "System connected successfully",
-                "details": strings.TrimSpace(string(output)),
-            }
-        }
-        
-    case "agents":
-        // Test agent creation
-        cmd := exec.Command("dagger", "call", "create-agent", "--name", "ui-test", "--type", "code")
-        _, err := cmd.Output()
-        if err != nil {
-            result = map[string]interface{}{
-                "success": false,
-                "error": "Agent creation failed",
-            }
-        } else {
-            result = map[string]interface{}{
-                "success": true,
-                "message": "Agent created and executed successfully",
-                "details": "Code agent 'ui-test' created",
-            }
+    switch c.format {
+    case "json":
+        c.writeJSON(run)
+    case "junit":
+        err = writeJUnitReport(os.Stdout, run)
+    case "tap":
+        err = writeTAPReport(os.Stdout, run)
+    default:
+        printTestRun(os.Stdout, run)
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
+    }
+    return jobExitCode(run.State)
+}
+
+// printTestRun writes a finished test run as text, one line per step
+// followed by its assertions
+func printTestRun(w io.Writer, run JobView) {
+    fmt.Fprintf(w, "Suite %s: %s in %s\n", run.Name, run.State, time.Duration(run.DurationMS)*time.Millisecond)
+    for _, c := range reportCases(run) {
+        mark := "✅"
+        switch {
+        case c.Recovered:
+            mark = "↩️ "
+        case c.Status != InvocationOK:
+            mark = "❌"
         }
-        
-    case "a2a":
-        // A2A communication test - try to send a message
-        cmd := exec.Command("dagger", "call", "send-a-2-amessage", 
-            "--from", "agent-1", 
-            "--to", "agent-2", 
-            "--content", "UI test message")
-        output, err := cmd.Output()
-        if err != nil {
-            // If send fails, just initialize the mesh
-            cmd = exec.Command("dagger", "call", "initialize-a-2-amesh", "stdout")
-            output, err = cmd.Output()
-            if err != nil {
-                result = map[string]interface{}{
-                    "success": false,
-                    "error": "A2A communication test failed",
-                }
-            } else {
-                result = map[string]interface{}{
-                    "success": true,
-                    "message": "A2A mesh initialized",
-                    "details": strings.TrimSpace(string(output)),
+        fmt.Fprintf(w, "  %s %s (%s, %dms)\n", mark, c.Name, c.Status, c.DurationMS)
+        if c.Status != InvocationOK || len(c.Assertions) > 0 {
+            for _, line := range strings.Split(c.failureText(), "\n") {
+                if line != "" {
+                    fmt.Fprintf(w, "       %s\n", line)
                 }
             }
-        } else {
-            result = map[string]interface{}{
-                "success": true,
-                "message": "A2A message sent successfully",
-                "details": fmt.Sprintf("Message delivered from agent-1 to agent-2\n%s", strings.TrimSpace(string(output))),
-            }
-        }
-        
-    case "learning":
-        // Learning system test
-        experience := `{"task":"ui-test","success":true,"agents":["code"],"duration":1000}`
-        cmd := exec.Command("dagger", "call", "learn-from-experience", "--experience", experience)
-        _, err := cmd.Output()
-        if err != nil {
-            result = map[string]interface{}{
-                "success": false,
-                "error": "Learning system failed",
-            }
-        } else {
-            result = map[string]interface{}{
-                "success": true,
-                "message": "Experience learned successfully",
-                "details": "System learned from test experience",
-            }
-        }
-        
-    case "pipeline":
-        // Pipeline test
-        cmd := exec.Command("dagger", "call", "execute-agent-pipeline", 
-            "--agents", `["code","test","review"]`,
-            "--task", "UI test pipeline")
-        output, err := cmd.Output()
-        if err != nil {
-            result = map[string]interface{}{
-                "success": false,
-                "error": "Pipeline execution failed",
-            }
-        } else {
-            result = map[string]interface{}{
-                "success": true,
-                "message": "Pipeline executed successfully",
-                "details": strings.TrimSpace(string(output)),
-            }
         }
-        
-    case "stress":
-        // Stress test (simplified for UI)
-        result = map[string]interface{}{
-            "success": true,
-            "message": "Stress test initiated",
-            "details": "10 agents deployed, monitoring performance...",
+    }
+    if message, _ := run.Result["message"].(string); message != "" {
+        fmt.Fprintln(w, message)
+    }
+    if message, _ := run.Result["error"].(string); message != "" {
+        fmt.Fprintln(w, "Error:", message)
+    }
+}
+
+// cliExec runs a dashboard command as a job, exactly as POST /api/execute
+// does
+func cliExec(cfg ServerConfig, args []string) int {
+    c := newCLICommand("exec", "exec <command> [flags]", &cfg, "text", "json")
+    verbose := c.flags.Bool("v", false, "stream the Dagger output to stderr while the command runs")
+    rawArgs := map[string]string{}
+    c.flags.Func("arg", "command argument as name=value (repeatable)", func(v string) error {
+        name, value, ok := strings.Cut(v, "=")
+        if !ok {
+            return fmt.Errorf("want name=value, got %q", v)
         }
-        
-        // In background, actually run a lighter stress test
-        go func() {
-            exec.Command("dagger", "call", "execute-agents-parallel", "--task", "Stress test").Run()
-        }()
-        
-    default:
-        result = map[string]interface{}{
-            "success": false,
-            "error": fmt.Sprintf("Unknown test suite: %s", request.Suite),
+        rawArgs[name] = value
+        return nil
+    })
+    positional, err := c.parse(args, 1)
+    if err != nil {
+        return c.exitCode(err)
+    }
+    server, err := c.server()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
+    }
+    
+    spec, fn, err := server.prepareCommand(positional[0], cliCommandArgs(server.commands.Get(positional[0]), rawArgs))
+    if errors.Is(err, ErrUnknownCommand) {
+        var names []string
+        for _, command := range server.commands.All() {
+            names = append(names, command.Name)
         }
+        return c.exitCode(c.usageError("%v (available: %s)", err, strings.Join(names, ", ")))
+    }
+    if err != nil {
+        return c.exitCode(c.usageError("%v", err))
+    }
+    spec.Initiator = "cli"
+    run, err := runCLIJob(server, spec, *verbose, fn)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return exitFailed
     }
     
-    json.NewEncoder(w).Encode(result)
+    if c.format == "json" {
+        c.writeJSON(run)
+    } else if output, _ := run.Result["output"].(string); run.State == JobSucceeded {
+        fmt.Println(output)
+    } else {
+        fmt.Fprintln(os.Stderr, output)
+    }
+    return jobExitCode(run.State)
 }
 
-func main() {
-    // Read dashboard HTML
-    dashboardPath := "dashboard.html"
-    if _, err := os.Stat("/app/dashboard.html"); err == nil {
-        dashboardPath = "/app/dashboard.html"
+// cliCommandArgs types --arg values for a command: string parameters take
+// the text as is, anything else is decoded as JSON
+func cliCommandArgs(command *Command, raw map[string]string) map[string]interface{} {
+    types := map[string]string{}
+    if command != nil {
+        for _, param := range command.Params {
+            types[param.Name] = param.Type
+        }
+    }
+    args := make(map[string]interface{}, len(raw))
+    for name, value := range raw {
+        var typed interface{}
+        if types[name] == "string" || json.Unmarshal([]byte(value), &typed) != nil {
+            typed = value
+        }
+        args[name] = typed
     }
+    return args
+}
+
+// runCLIJob runs fn as a job and waits for it, cancelling it on SIGINT or
+// SIGTERM. With verbose the job's log is copied to stderr as it arrives.
+func runCLIJob(server *Server, spec JobSpec, verbose bool, fn func(ctx context.Context) map[string]interface{}) (JobView, error) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
     
-    dashboardHTML, err := os.ReadFile(dashboardPath)
+    job, err := server.jobs.Start(ctx, spec, fn)
     if err != nil {
-        log.Fatal("Failed to read dashboard HTML:", err)
+        return JobView{}, err
     }
+    followed := make(chan struct{})
+    go func() {
+        defer close(followed)
+        if verbose {
+            followJobLog(job, os.Stderr)
+        }
+    }()
     
-    // Routes
-    http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Content-Type", "text/html")
-        w.Write(dashboardHTML)
-    })
-    
-    http.HandleFunc("/api/status", corsMiddleware(statusHandler))
-    http.HandleFunc("/api/metrics", corsMiddleware(metricsHandler))
-    http.HandleFunc("/api/events", corsMiddleware(eventsHandler))
-    http.HandleFunc("/api/execute", corsMiddleware(executeHandler))
-    http.HandleFunc("/api/test", corsMiddleware(testHandler))
+    select {
+    case <-job.Done():
+    case <-ctx.Done():
+        server.jobs.Cancel(job.ID)
+        <-job.Done()
+    }
+    <-followed
+    return job.View(), nil
+}
+
+// followJobLog copies a job's log lines to w until the job finishes
+func followJobLog(job *Job, w io.Writer) {
+    seq := 0
+    for {
+        lines, notify, finished := job.LogsAfter(seq)
+        for _, line := range lines {
+            fmt.Fprintf(w, "[%s] %s\n", line.Function, line.Line)
+            seq = line.Seq
+        }
+        if finished {
+            return
+        }
+        <-notify
+    }
+}
+
+// jobExitCode maps a finished job's state to the CLI exit code
+func jobExitCode(state string) int {
+    switch state {
+    case JobSucceeded:
+        return exitOK
+    case JobTimedOut:
+        return exitTimedOut
+    case JobCancelled:
+        return exitCancelled
+    }
+    return exitFailed
+}
+
+// cliRuns lists recorded runs with the filters of GET /api/runs. It only
+// reads the run store, so it is safe alongside a running server.
+func cliRuns(cfg ServerConfig, args []string) int {
+    c := newCLICommand("runs", "runs list [flags]", &cfg, "text", "json")
+    params := url.Values{}
+    for _, param := range [][2]string{
+        {"suite", "only runs of this test suite"},
+        {"command", "only runs of this command"},
+        {"kind", "only runs of this kind (test or command)"},
+        {"status", "only runs in this state"},
+        {"from", "only runs started at or after this time (RFC 3339 or unix seconds)"},
+        {"to", "only runs started before this time"},
+        {"limit", "page size, 1-500 (default 50)"},
+        {"offset", "number of runs to skip"},
+    } {
+        name := param[0]
+        c.flags.Func(name, param[1], func(v string) error {
+            params.Set(name, v)
+            return nil
+        })
+    }
+    positional, err := c.parse(args, 1)
+    if err != nil {
+        return c.exitCode(err)
+    }
+    if positional[0] != "list" {
+        return c.exitCode(c.usageError("unknown runs command %q", positional[0]))
+    }
+    q, err := parseRunQuery(params)
+    if err != nil {
+        return c.exitCode(c.usageError("%v", err))
+    }
     
-    fmt.Println("🌐 ProactivaDev Web Management Interface starting on port 8080")
-    fmt.Println("📊 Dashboard: http://localhost:8080")
-    fmt.Println("🔌 API: http://localhost:8080/api/status")
-    fmt.Println("📈 SSE: http://localhost:8080/api/events")
+    runs, err := OpenRunStore(storePath(cfg, "runs"), cfg.RunsRetention)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "failed to open run store:", err)
+        return exitFailed
+    }
+    page := runs.Page(q)
+    if c.format == "json" {
+        c.writeJSON(page)
+        return exitOK
+    }
     
-    log.Fatal(http.ListenAndServe(":8080", nil))
-}
\ No newline at end of file
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tKIND\tNAME\tSTATE\tSTARTED\tDURATION\tINITIATOR")
+    for _, run := range page["runs"].([]JobView) {
+        started := run.StartedAt
+        if started == "" {
+            started = run.CreatedAt
+        }
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", run.ID, run.Kind, run.Name, run.State,
+            started, time.Duration(run.DurationMS)*time.Millisecond, run.Initiator)
+    }
+    tw.Flush()
+    fmt.Printf("%d of %d runs\n", len(page["runs"].([]JobView)), page["total"])
+    return exitOK
+}
@@ -0,0 +1,2337 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "slices"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "testing/synctest"
+    "time"
+)
+
+// testSuitesJSON is the suites file the handler tests load
+const testSuitesJSON = `{"suites": [{
+    "name": "smoke",
+    "description": "Connection check",
+    "message": "Smoke test passed",
+    "failure_message": "Smoke test failed",
+    "steps": [{"function": "test-connection", "expect": [{"type": "contains", "value": "OK"}]}]
+}]}`
+
+// newTestServer builds a Server on a FakeRunner with the default fake
+// responses, a temporary data directory and the smoke suite
+func newTestServer(t *testing.T) (*Server, *FakeRunner) {
+    t.Helper()
+    dir := t.TempDir()
+    suites := filepath.Join(dir, "test-suites.json")
+    if err := os.WriteFile(suites, []byte(testSuitesJSON), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    
+    runner := NewFakeRunner(defaultFakeResponses())
+    server, err := NewServer(runner, ServerConfig{
+        Timeouts:         defaultDaggerTimeouts(),
+        StatusInterval:   time.Minute,
+        DataDir:          dir,
+        MetricsRetention: time.Hour,
+        RunsRetention:    time.Hour,
+        EventReplay:      100,
+        SSERetry:         time.Second,
+        SSEHeartbeat:     time.Second,
+        MaxConcurrent:    2,
+        QueueSize:        4,
+        TestSuites:       suites,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return server, runner
+}
+
+func TestHandlers(t *testing.T) {
+    tests := []struct {
+        name   string
+        method string
+        path   string
+        body   string
+        origin string
+        status int
+        want   string
+        calls  []string
+    }{
+        {
+            name:   "status",
+            method: "GET", path: "/api/status",
+            status: http.StatusOK, want: `"connected":true`,
+            calls:  []string{"functions", "get-system-status"},
+        },
+        {
+            name:   "commands",
+            method: "GET", path: "/api/commands",
+            status: http.StatusOK, want: `"name":"initialize"`,
+        },
+        {
+            name:   "execute and wait",
+            method: "POST", path: "/api/execute?wait=true", body: `{"command": "initialize"}`,
+            status: http.StatusOK, want: "connection OK",
+            calls:  []string{"test-connection"},
+        },
+        {
+            name:   "execute as a job",
+            method: "POST", path: "/api/execute", body: `{"command": "initialize"}`,
+            status: http.StatusAccepted, want: `"kind":"command"`,
+            calls:  []string{"test-connection"},
+        },
+        {
+            name:   "execute unknown command",
+            method: "POST", path: "/api/execute", body: `{"command": "nope"}`,
+            status: http.StatusNotFound, want: "unknown command",
+        },
+        {
+            name:   "execute with a bad priority",
+            method: "POST", path: "/api/execute", body: `{"command": "initialize", "priority": "urgent"}`,
+            status: http.StatusBadRequest, want: "invalid priority",
+        },
+        {
+            name:   "functions",
+            method: "GET", path: "/api/functions",
+            status: http.StatusOK, want: `"name":"test-connection"`,
+            calls:  []string{"functions"},
+        },
+        {
+            name:   "describe function",
+            method: "GET", path: "/api/functions/test-connection",
+            status: http.StatusOK, want: `"described":true`,
+            calls:  []string{"functions", "test-connection"},
+        },
+        {
+            name:   "unknown function",
+            method: "GET", path: "/api/functions/nope",
+            status: http.StatusNotFound, want: "unknown function",
+            calls:  []string{"functions"},
+        },
+        {
+            name:   "suites",
+            method: "GET", path: "/api/test/suites",
+            status: http.StatusOK, want: `"name":"smoke"`,
+        },
+        {
+            name:   "run suite",
+            method: "POST", path: "/api/test?wait=true", body: `{"suite": "smoke"}`,
+            status: http.StatusOK, want: `"success":true`,
+            calls:  []string{"test-connection"},
+        },
+        {
+            name:   "unknown suite",
+            method: "POST", path: "/api/test", body: `{"suite": "nope"}`,
+            status: http.StatusBadRequest, want: "Unknown test suite",
+        },
+        {
+            name:   "suite request that is not JSON",
+            method: "POST", path: "/api/test", body: `suite=smoke`,
+            status: http.StatusBadRequest, want: "Invalid request",
+        },
+        {
+            name:   "create agent",
+            method: "POST", path: "/api/agents?wait=true", body: `{"name": "coder", "type": "code", "options": {"language": "go"}}`,
+            status: http.StatusOK, want: `"name":"coder"`,
+            calls:  []string{"create-code-agent"},
+        },
+        {
+            name:   "create agent of an unknown type",
+            method: "POST", path: "/api/agents", body: `{"name": "coder", "type": "wizard"}`,
+            status: http.StatusBadRequest, want: "unknown agent type",
+        },
+        {
+            name:   "unknown agent",
+            method: "GET", path: "/api/agents/agent-nope/metrics",
+            status: http.StatusNotFound, want: "unknown agent",
+        },
+        {
+            name:   "unknown job",
+            method: "GET", path: "/api/jobs/job-nope",
+            status: http.StatusNotFound, want: "unknown job",
+        },
+        {
+            name:   "cross-origin state change",
+            method: "POST", path: "/api/execute", body: `{"command": "initialize"}`, origin: "https://evil.example",
+            status: http.StatusForbidden, want: "origin not allowed",
+        },
+        {
+            name:   "cross-origin read",
+            method: "GET", path: "/api/commands", origin: "https://evil.example",
+            status: http.StatusOK, want: `"name":"initialize"`,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, runner := newTestServer(t)
+            req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+            if tt.origin != "" {
+                req.Header.Set("Origin", tt.origin)
+            }
+            rec := httptest.NewRecorder()
+            server.routes().ServeHTTP(rec, req)
+            // Jobs answered with 202 finish before the data directory goes
+            for _, view := range server.jobs.List("", "") {
+                waitDone(t, server.jobs.Get(view.ID))
+            }
+    
+            if rec.Code != tt.status {
+                t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+            }
+            if !strings.Contains(rec.Body.String(), tt.want) {
+                t.Errorf("body %s does not contain %s", rec.Body, tt.want)
+            }
+    
+            var calls []string
+            for _, inv := range runner.Invocations() {
+                calls = append(calls, inv.Function)
+            }
+            if strings.Join(calls, ",") != strings.Join(tt.calls, ",") {
+                t.Errorf("calls = %v, want %v", calls, tt.calls)
+            }
+        })
+    }
+}
+
+// maskedFrame encodes a client frame, which RFC 6455 requires to be masked
+func maskedFrame(fin bool, opcode byte, payload string) []byte {
+    first := opcode
+    if fin {
+        first |= 0x80
+    }
+    mask := [4]byte{1, 2, 3, 4}
+    frame := []byte{first, 0x80 | byte(len(payload))}
+    frame = append(frame, mask[:]...)
+    for i := 0; i < len(payload); i++ {
+        frame = append(frame, payload[i]^mask[i%4])
+    }
+    return frame
+}
+
+// serverFrame is what wsConn.WriteMessage sends for a short payload
+func serverFrame(opcode byte, payload []byte) []byte {
+    return append([]byte{0x80 | opcode, byte(len(payload))}, payload...)
+}
+
+func TestWSReadMessage(t *testing.T) {
+    frames := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+    tests := []struct {
+        name    string
+        input   []byte
+        opcode  byte
+        payload string
+        err     string
+        written []byte
+    }{
+        {
+            name:    "single text frame",
+            input:   maskedFrame(true, wsText, "hello"),
+            opcode:  wsText,
+            payload: "hello",
+        },
+        {
+            name:    "fragmented with a ping in between",
+            input:   frames(maskedFrame(false, wsText, "hel"), maskedFrame(true, wsPing, "p"), maskedFrame(true, wsContinuation, "lo")),
+            opcode:  wsText,
+            payload: "hello",
+            written: serverFrame(wsPong, []byte("p")),
+        },
+        {
+            name:    "data frame inside a fragmented message",
+            input:   frames(maskedFrame(false, wsText, "hel"), maskedFrame(true, wsText, "lo")),
+            err:     "data frame inside a fragmented message",
+            written: serverFrame(wsClose, closePayload(1002, "data frame inside a fragmented message")),
+        },
+        {
+            name:    "continuation without a message",
+            input:   maskedFrame(true, wsContinuation, "lo"),
+            err:     "unexpected continuation frame",
+            written: serverFrame(wsClose, closePayload(1002, "unexpected continuation frame")),
+        },
+        {
+            name:    "unknown opcode",
+            input:   maskedFrame(true, 0x3, ""),
+            err:     "unknown websocket opcode",
+            written: serverFrame(wsClose, closePayload(1002, "unknown opcode")),
+        },
+        {
+            name:  "unmasked frame",
+            input: []byte{0x80 | wsText, 2, 'h', 'i'},
+            err:   "client frames must be masked",
+        },
+        {
+            name:    "close",
+            input:   maskedFrame(true, wsClose, string(closePayload(1000, ""))),
+            err:     io.EOF.Error(),
+            written: serverFrame(wsClose, closePayload(1000, "")),
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, client := net.Pipe()
+            written := make(chan []byte)
+            go func() {
+                data, _ := io.ReadAll(client)
+                written <- data
+            }()
+    
+            c := &wsConn{conn: server, reader: bufio.NewReader(bytes.NewReader(tt.input))}
+            opcode, payload, err := c.ReadMessage()
+            server.Close()
+    
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Errorf("err = %v, want %q", err, tt.err)
+                }
+            } else if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            } else if opcode != tt.opcode || string(payload) != tt.payload {
+                t.Errorf("got %#x %q, want %#x %q", opcode, payload, tt.opcode, tt.payload)
+            }
+            if got := <-written; !bytes.Equal(got, tt.written) {
+                t.Errorf("wrote %v, want %v", got, tt.written)
+            }
+        })
+    }
+}
+
+func TestAssertionEvaluate(t *testing.T) {
+    threshold := func(v float64) *float64 { return &v }
+    status := `{"success_rate": 0.9, "agents": [{"name": "a1"}, {"name": "a2"}], "components": {"memory": {"status": "healthy"}}}`
+    tests := []struct {
+        name      string
+        assertion Assertion
+        output    string
+        passed    bool
+        actual    interface{}
+        err       string
+    }{
+        {"contains", Assertion{Type: "contains", Value: "OK"}, "connection OK", true, nil, ""},
+        {"contains missing", Assertion{Type: "contains", Value: "OK"}, "down", false, nil, ""},
+        {"not contains", Assertion{Type: "not_contains", Value: "error"}, "fine", true, nil, ""},
+        {"regex", Assertion{Type: "regex", Value: `\d+ functions`}, "System operational - 12 functions available", true, "12 functions", ""},
+        {"json path", Assertion{Type: "json_path", Path: "components.memory.status", Equals: "healthy"}, status, true, "healthy", ""},
+        {"json path index", Assertion{Type: "json_path", Path: "$.agents[1].name", Equals: "a1"}, status, false, "a2", ""},
+        {"json path not JSON", Assertion{Type: "json_path", Path: "x", Equals: 1.0}, "plain", false, nil, "output is not JSON"},
+        {"threshold on a path", Assertion{Type: "threshold", Path: "success_rate", Op: ">=", Threshold: threshold(0.8)}, status, true, 0.9, ""},
+        {"threshold on the output", Assertion{Type: "threshold", Op: "<", Threshold: threshold(10)}, "12", false, 12.0, ""},
+        {"threshold on a string", Assertion{Type: "threshold", Path: "components.memory.status", Op: ">", Threshold: threshold(0)}, status, false, "healthy", "is not a number"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := tt.assertion.validate(); err != nil {
+                t.Fatal(err)
+            }
+            result := tt.assertion.Evaluate(tt.output)
+            if result.Passed != tt.passed {
+                t.Errorf("passed = %t, want %t (%+v)", result.Passed, tt.passed, result)
+            }
+            if result.Actual != tt.actual {
+                t.Errorf("actual = %#v, want %#v", result.Actual, tt.actual)
+            }
+            if !strings.Contains(result.Error, tt.err) || (tt.err == "") != (result.Error == "") {
+                t.Errorf("error = %q, want %q", result.Error, tt.err)
+            }
+        })
+    }
+}
+
+func TestOutputPath(t *testing.T) {
+    doc := `{"a": {"b": [10, {"c": "deep"}]}, "list": [[1, 2], [3]]}`
+    tests := []struct {
+        path string
+        want string
+        err  string
+    }{
+        {path: "", want: `{"a":{"b":[10,{"c":"deep"}]},"list":[[1,2],[3]]}`},
+        {path: "$", want: `{"a":{"b":[10,{"c":"deep"}]},"list":[[1,2],[3]]}`},
+        {path: "a.b[0]", want: `10`},
+        {path: "$.a.b[1].c", want: `"deep"`},
+        {path: "list[0][1]", want: `2`},
+        {path: "a.missing", err: "missing: no such key"},
+        {path: "a.b.c", err: "c: not an object"},
+        {path: "a.b[2]", err: "index out of range"},
+        {path: "a.b[x]", err: "bad index"},
+    }
+    
+    for _, tt := range tests {
+        got, err := outputPath(doc, tt.path)
+        if tt.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Errorf("outputPath(%q) err = %v, want %q", tt.path, err, tt.err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("outputPath(%q): %v", tt.path, err)
+            continue
+        }
+        if encoded, _ := json.Marshal(got); string(encoded) != tt.want {
+            t.Errorf("outputPath(%q) = %s, want %s", tt.path, encoded, tt.want)
+        }
+    }
+}
+
+// reportRun is a finished suite run with a passing, a failing, a timed out
+// and a recovered step
+func reportRun() JobView {
+    return JobView{
+        ID:         "job-1",
+        Kind:       "test",
+        Name:       "smoke",
+        State:      JobFailed,
+        StartedAt:  "2026-01-01T12:00:00Z",
+        DurationMS: 4500,
+        Result: map[string]interface{}{
+            "success": false,
+            "steps": []StepResult{
+                {Name: "connect", Function: "test-connection", Status: InvocationOK, DurationMS: 1000},
+                {Name: "status", Function: "get-system-status", Status: InvocationFailed, DurationMS: 1000, Error: "assertion failed",
+                    Assertions: []AssertionResult{{Assertion: `contains "healthy"`, Passed: false}}},
+                {Name: "slow", Function: "run-stress", Status: InvocationTimedOut, DurationMS: 2000, Error: "timed out"},
+                {Name: "flaky", Function: "send-a-2-amessage", Status: InvocationFailed, DurationMS: 250, Error: "exit 1"},
+                {Name: "flaky fallback", Function: "test-connection", Status: InvocationOK, DurationMS: 250, Fallback: true},
+            },
+        },
+        Invocations: []JobInvocation{
+            {Function: "test-connection", Output: "connection OK\n"},
+            {Function: "get-system-status", Output: "degraded"},
+        },
+    }
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+    var b bytes.Buffer
+    if err := writeJUnitReport(&b, reportRun()); err != nil {
+        t.Fatal(err)
+    }
+    
+    var report junitTestSuites
+    if err := xml.Unmarshal(b.Bytes(), &report); err != nil {
+        t.Fatalf("invalid XML: %v\n%s", err, b.String())
+    }
+    if report.Tests != 5 || report.Failures != 1 || report.Errors != 1 || report.Time != "4.500" {
+        t.Errorf("totals = %d tests, %d failures, %d errors in %s", report.Tests, report.Failures, report.Errors, report.Time)
+    }
+    suite := report.Suites[0]
+    if suite.Skipped != 1 || len(suite.Cases) != 5 {
+        t.Fatalf("suite has %d cases, %d skipped", len(suite.Cases), suite.Skipped)
+    }
+    
+    cases := suite.Cases
+    if cases[0].Classname != "proactiva.smoke" || cases[0].SystemOut != "connection OK\n" || cases[0].Failure != nil {
+        t.Errorf("passing case = %+v", cases[0])
+    }
+    if cases[1].Failure == nil || !strings.Contains(cases[1].Failure.Text, `FAIL contains "healthy"`) {
+        t.Errorf("failing case = %+v", cases[1])
+    }
+    if cases[2].Error == nil || cases[2].Error.Type != InvocationTimedOut {
+        t.Errorf("timed out case = %+v", cases[2])
+    }
+    if cases[3].Skipped == nil || cases[3].Failure != nil {
+        t.Errorf("recovered case = %+v", cases[3])
+    }
+}
+
+func TestWriteTAPReport(t *testing.T) {
+    var b bytes.Buffer
+    if err := writeTAPReport(&b, reportRun()); err != nil {
+        t.Fatal(err)
+    }
+    
+    var points []string
+    for _, line := range strings.Split(b.String(), "\n") {
+        if strings.HasPrefix(line, "ok ") || strings.HasPrefix(line, "not ok ") {
+            points = append(points, line)
+        }
+    }
+    want := []string{
+        "ok 1 - connect",
+        "not ok 2 - status",
+        "not ok 3 - slow",
+        "ok 4 - flaky # SKIP replaced by fallback",
+        "ok 5 - flaky fallback",
+    }
+    if strings.Join(points, "\n") != strings.Join(want, "\n") {
+        t.Errorf("test points:\n%s\nwant:\n%s", strings.Join(points, "\n"), strings.Join(want, "\n"))
+    }
+    for _, line := range []string{"TAP version 13\n1..5\n", `    - assertion: "contains \"healthy\""`, "  output: |\n    connection OK\n  ...\n"} {
+        if !strings.Contains(b.String(), line) {
+            t.Errorf("report lacks %q:\n%s", line, b.String())
+        }
+    }
+    
+    // A run cancelled before its first step is one failed point
+    b.Reset()
+    cancelled := JobView{ID: "job-2", Name: "smoke", State: JobCancelled,
+        Result: map[string]interface{}{"status": InvocationCancelled, "error": "Cancelled while queued"}}
+    if err := writeTAPReport(&b, cancelled); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(b.String(), "1..1\n") || !strings.Contains(b.String(), "not ok 1 - smoke\n") {
+        t.Errorf("cancelled run report:\n%s", b.String())
+    }
+}
+
+func TestKebabCase(t *testing.T) {
+    tests := map[string]string{
+        "testConnection":    "test-connection",
+        "initializeA2AMesh": "initialize-a-2-amesh",
+        "sendA2AMessage":    "send-a-2-amessage",
+        "getHTTPStatus":     "get-httpstatus",
+        "agent2":            "agent-2",
+        "v2Api":             "v-2-api",
+        "status":            "status",
+    }
+    for name, want := range tests {
+        if got := kebabCase(name); got != want {
+            t.Errorf("kebabCase(%q) = %q, want %q", name, got, want)
+        }
+    }
+}
+
+func TestCamelCase(t *testing.T) {
+    tests := map[string]string{
+        "with-exec":      "withExec",
+        "stdout":         "stdout",
+        "as-json-string": "asJsonString",
+        "trailing-":      "trailing",
+    }
+    for name, want := range tests {
+        if got := camelCase(name); got != want {
+            t.Errorf("camelCase(%q) = %q, want %q", name, got, want)
+        }
+    }
+}
+
+// gqlTestModule is the introspection answer of the GraphQL stub
+const gqlTestModule = `{"name": "ProactivaDev", "objects": [{"asObject": {"name": "ProactivaDev", "functions": [
+    {"name": "testConnection", "args": [], "returnType": {"kind": "STRING_KIND"}},
+    {"name": "createAgent", "args": [
+        {"name": "name", "typeDef": {"kind": "STRING_KIND"}},
+        {"name": "retries", "defaultValue": "3", "typeDef": {"kind": "INTEGER_KIND"}},
+        {"name": "verbose", "typeDef": {"kind": "BOOLEAN_KIND", "optional": true}},
+        {"name": "tags", "typeDef": {"kind": "LIST_KIND", "optional": true, "asList": {"elementTypeDef": {"kind": "STRING_KIND"}}}},
+        {"name": "mode", "typeDef": {"kind": "ENUM_KIND", "optional": true, "asEnum": {"name": "Mode", "values": [{"name": "FAST"}]}}}
+    ], "returnType": {"kind": "STRING_KIND"}},
+    {"name": "initializeA2AMesh", "args": [], "returnType": {"kind": "OBJECT_KIND", "asObject": {"name": "Container"}}}
+]}}]}`
+
+func TestGraphQLRunnerCall(t *testing.T) {
+    var queries []string
+    var answer string
+    stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body struct {
+            Query string `json:"query"`
+        }
+        json.NewDecoder(r.Body).Decode(&body)
+        switch {
+        case strings.Contains(body.Query, "serve"):
+            io.WriteString(w, `{"data": {"moduleSource": {"asModule": {"serve": null}}}}`)
+        case strings.Contains(body.Query, "objects"):
+            io.WriteString(w, `{"data": {"moduleSource": {"asModule": `+gqlTestModule+`}}}`)
+        default:
+            queries = append(queries, body.Query)
+            io.WriteString(w, answer)
+        }
+    }))
+    defer stub.Close()
+    
+    tests := []struct {
+        name     string
+        function string
+        args     []string
+        answer   string
+        query    string
+        output   string
+        err      string
+    }{
+        {
+            name:     "no arguments",
+            function: "test-connection",
+            answer:   `{"data": {"proactivaDev": {"testConnection": "connected"}}}`,
+            query:    `query { proactivaDev { testConnection } }`,
+            output:   "connected",
+        },
+        {
+            name:     "typed arguments",
+            function: "create-agent",
+            args:     []string{"--name", `say "hi"`, "--retries=5", "--verbose", "--tags", "a,b", "--mode", "FAST"},
+            answer:   `{"data": {"proactivaDev": {"createAgent": "created"}}}`,
+            query:    `query { proactivaDev { createAgent(name: "say \"hi\"", retries: 5, verbose: true, tags: ["a", "b"], mode: FAST) } }`,
+            output:   "created",
+        },
+        {
+            name:     "JSON list argument",
+            function: "create-agent",
+            args:     []string{"--name", "a", "--tags", `["x,y", "z", 3]`},
+            answer:   `{"data": {"proactivaDev": {"createAgent": "created"}}}`,
+            query:    `query { proactivaDev { createAgent(name: "a", tags: ["x,y", "z", "3"]) } }`,
+            output:   "created",
+        },
+        {
+            name:     "object result is evaluated",
+            function: "initialize-a-2-amesh",
+            answer:   `{"data": {"proactivaDev": {"initializeA2AMesh": {"id": "xyz"}}}}`,
+            query:    `query { proactivaDev { initializeA2AMesh { id } } }`,
+            output:   "Container evaluated",
+        },
+        {
+            name:     "field chain",
+            function: "initialize-a-2-amesh",
+            args:     []string{"with-exec", "stdout"},
+            answer:   `{"data": {"proactivaDev": {"initializeA2AMesh": {"withExec": {"stdout": "mesh up"}}}}}`,
+            query:    `query { proactivaDev { initializeA2AMesh { withExec { stdout } } } }`,
+            output:   "mesh up",
+        },
+        {
+            name:     "engine error",
+            function: "test-connection",
+            answer:   `{"errors": [{"message": "boom"}]}`,
+            query:    `query { proactivaDev { testConnection } }`,
+            err:      "boom",
+        },
+        {name: "unknown argument", function: "create-agent", args: []string{"--bogus", "1"}, err: "has no argument --bogus"},
+        {name: "bad integer", function: "create-agent", args: []string{"--retries", "many"}, err: `"many" is not an integer`},
+        {name: "bad enum value", function: "create-agent", args: []string{"--mode", "not valid"}, err: "is not an enum value"},
+        {name: "missing value", function: "create-agent", args: []string{"--name"}, err: "--name needs a value"},
+        {name: "unknown function", function: "nope", err: "has no function nope"},
+    }
+    
+    runner := &GraphQLRunner{URL: stub.URL, Module: ".", Client: stub.Client()}
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            queries, answer = nil, tt.answer
+            output, err := runner.Call(context.Background(), tt.function, tt.args...)
+    
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Errorf("err = %v, want %q", err, tt.err)
+                }
+            } else if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            } else if string(output) != tt.output {
+                t.Errorf("output = %q, want %q", output, tt.output)
+            }
+    
+            var want []string
+            if tt.query != "" {
+                want = []string{tt.query}
+            }
+            if strings.Join(queries, "\n") != strings.Join(want, "\n") {
+                t.Errorf("queries = %q, want %q", queries, want)
+            }
+        })
+    }
+}
+
+func TestGraphQLRunnerRefreshDoesNotBlockCalls(t *testing.T) {
+    var introspections atomic.Int32
+    refreshing := make(chan struct{})
+    release := make(chan struct{})
+    stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body struct {
+            Query string `json:"query"`
+        }
+        json.NewDecoder(r.Body).Decode(&body)
+        switch {
+        case strings.Contains(body.Query, "serve"):
+            io.WriteString(w, `{"data": {"moduleSource": {"asModule": {"serve": null}}}}`)
+        case strings.Contains(body.Query, "objects"):
+            if introspections.Add(1) > 1 {
+                close(refreshing)
+                <-release
+            }
+            io.WriteString(w, `{"data": {"moduleSource": {"asModule": `+gqlTestModule+`}}}`)
+        default:
+            io.WriteString(w, `{"data": {"proactivaDev": {"testConnection": "connected"}}}`)
+        }
+    }))
+    defer stub.Close()
+    defer close(release)
+    
+    runner := &GraphQLRunner{URL: stub.URL, Module: ".", Client: stub.Client()}
+    if _, err := runner.Call(context.Background(), "test-connection"); err != nil {
+        t.Fatalf("first call: %v", err)
+    }
+    
+    // A refresh stalled on the engine must not hold up calls that can be
+    // served from the schema already loaded
+    go runner.Functions(context.Background())
+    <-refreshing
+    
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    output, err := runner.Call(ctx, "test-connection")
+    if err != nil {
+        t.Fatalf("call during refresh: %v", err)
+    }
+    if string(output) != "connected" {
+        t.Errorf("output = %q, want %q", output, "connected")
+    }
+}
+
+func TestEventBusSubscribeFrom(t *testing.T) {
+    bus := NewEventBus(8, 3)
+    for i := 0; i < 5; i++ {
+        bus.Publish(NewEvent(EventJobQueued, nil))
+    }
+    bus.Publish(NewEvent(EventAgentCreated, map[string]interface{}{"agent": "a1"}))
+    // The ring now holds events 4, 5 and 6
+    
+    tests := []struct {
+        name      string
+        lastID    uint64
+        filter    EventFilter
+        replay    []uint64
+        truncated bool
+    }{
+        {name: "no replay", lastID: 0},
+        {name: "caught up", lastID: 6, replay: nil},
+        {name: "within the ring", lastID: 4, replay: []uint64{5, 6}},
+        {name: "just before the ring", lastID: 3, replay: []uint64{4, 5, 6}},
+        {name: "fell behind", lastID: 1, replay: []uint64{4, 5, 6}, truncated: true},
+        {name: "from before a restart", lastID: 99, replay: []uint64{4, 5, 6}, truncated: true},
+        {name: "filtered", lastID: 3, filter: EventFilter{Topics: map[string]bool{"agents": true}}, replay: []uint64{6}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sub, replay, truncated := bus.SubscribeFrom(tt.lastID, tt.filter)
+            defer bus.Unsubscribe(sub)
+    
+            var ids []uint64
+            for _, evt := range replay {
+                ids = append(ids, evt.ID)
+            }
+            if !slices.Equal(ids, tt.replay) || truncated != tt.truncated {
+                t.Errorf("replay %v truncated %t, want %v %t", ids, truncated, tt.replay, tt.truncated)
+            }
+        })
+    }
+    
+    // Events published after subscribing are delivered live, not replayed
+    sub, _, _ := bus.SubscribeFrom(6, EventFilter{})
+    defer bus.Unsubscribe(sub)
+    bus.Publish(NewEvent(EventJobStarted, nil))
+    select {
+    case evt := <-sub.C:
+        if evt.ID != 7 {
+            t.Errorf("live event ID = %d, want 7", evt.ID)
+        }
+    case <-time.After(time.Second):
+        t.Error("live event not delivered")
+    }
+}
+
+// blockingJob returns a job function that records its name on started and
+// runs until release is closed or the job is cancelled
+func blockingJob(name string, started chan<- string, release <-chan struct{}) func(ctx context.Context) map[string]interface{} {
+    return func(ctx context.Context) map[string]interface{} {
+        started <- name
+        select {
+        case <-release:
+            return map[string]interface{}{"success": true, "status": InvocationOK}
+        case <-ctx.Done():
+            return map[string]interface{}{"success": false, "status": InvocationCancelled}
+        }
+    }
+}
+
+func waitDone(t *testing.T, job *Job) {
+    t.Helper()
+    select {
+    case <-job.Done():
+    case <-time.After(5 * time.Second):
+        t.Fatalf("job %s did not finish", job.Name)
+    }
+}
+
+func TestJobManagerDispatch(t *testing.T) {
+    jobs := NewJobManager(NewEventBus(64, 100), 100, 1, 2)
+    started := make(chan string, 3)
+    release := make(chan struct{})
+    
+    first, err := jobs.Start(context.Background(), JobSpec{Name: "first"}, blockingJob("first", started, release))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if name := <-started; name != "first" {
+        t.Fatalf("started %s first", name)
+    }
+    background, err := jobs.Start(context.Background(), JobSpec{Name: "background", Priority: PriorityBackground}, blockingJob("background", started, release))
+    if err != nil {
+        t.Fatal(err)
+    }
+    interactive, err := jobs.Start(context.Background(), JobSpec{Name: "interactive"}, blockingJob("interactive", started, release))
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    // Interactive jobs jump ahead of queued background ones
+    if view := interactive.View(); view.State != JobQueued || view.Position != 1 {
+        t.Errorf("interactive job is %s at %d", view.State, view.Position)
+    }
+    if view := background.View(); view.State != JobQueued || view.Position != 2 {
+        t.Errorf("background job is %s at %d", view.State, view.Position)
+    }
+    
+    // One worker running and the queue at capacity
+    if _, err := jobs.Start(context.Background(), JobSpec{Name: "overflow"}, blockingJob("overflow", started, release)); !errors.Is(err, ErrQueueFull) {
+        t.Errorf("Start on a full queue: %v", err)
+    }
+    if _, err := jobs.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+        t.Errorf("Acquire on a full queue: %v", err)
+    }
+    
+    close(release)
+    for _, job := range []*Job{first, interactive, background} {
+        waitDone(t, job)
+        if state := job.View().State; state != JobSucceeded {
+            t.Errorf("%s finished %s", job.Name, state)
+        }
+    }
+    if order := []string{<-started, <-started}; order[0] != "interactive" || order[1] != "background" {
+        t.Errorf("ran queued jobs in order %v", order)
+    }
+    if running, queued := jobs.Stats(); running != 0 || queued[PriorityInteractive]+queued[PriorityBackground] != 0 {
+        t.Errorf("after finishing: %d running, %v queued", running, queued)
+    }
+}
+
+func TestJobManagerCancel(t *testing.T) {
+    jobs := NewJobManager(NewEventBus(64, 100), 100, 1, 2)
+    started := make(chan string, 2)
+    release := make(chan struct{})
+    defer close(release)
+    
+    running, _ := jobs.Start(context.Background(), JobSpec{Name: "running"}, blockingJob("running", started, release))
+    <-started
+    queued, _ := jobs.Start(context.Background(), JobSpec{Name: "queued"}, blockingJob("queued", started, release))
+    
+    // A queued job finishes at once without ever running
+    if !jobs.Cancel(queued.ID) {
+        t.Fatal("Cancel(queued) = false")
+    }
+    waitDone(t, queued)
+    if view := queued.View(); view.State != JobCancelled || view.Result["error"] != "Cancelled while queued" {
+        t.Errorf("queued job after cancel: %s %v", view.State, view.Result)
+    }
+    
+    // A running job has its context cancelled
+    if !jobs.Cancel(running.ID) {
+        t.Fatal("Cancel(running) = false")
+    }
+    waitDone(t, running)
+    if state := running.View().State; state != JobCancelled {
+        t.Errorf("running job after cancel: %s", state)
+    }
+    select {
+    case name := <-started:
+        t.Errorf("cancelled job %s ran", name)
+    default:
+    }
+    
+    if jobs.Cancel("job-nope") {
+        t.Error("Cancel of an unknown job = true")
+    }
+    if jobs.Cancel(running.ID) {
+        t.Error("Cancel of a finished job = true")
+    }
+}
+
+// readServerMessage reads the next text frame written by
+// wsConn.WriteMessage, skipping heartbeat pings, and decodes it
+func readServerMessage(t *testing.T, r io.Reader) wsMessage {
+    t.Helper()
+    var payload []byte
+    for {
+        header := make([]byte, 2)
+        if _, err := io.ReadFull(r, header); err != nil {
+            t.Fatal(err)
+        }
+        n := int(header[1])
+        if n == 126 {
+            ext := make([]byte, 2)
+            if _, err := io.ReadFull(r, ext); err != nil {
+                t.Fatal(err)
+            }
+            n = int(ext[0])<<8 | int(ext[1])
+        }
+        payload = make([]byte, n)
+        if _, err := io.ReadFull(r, payload); err != nil {
+            t.Fatal(err)
+        }
+        if header[0]&0x0f == wsText {
+            break
+        }
+    }
+    var msg wsMessage
+    if err := json.Unmarshal(payload, &msg); err != nil {
+        t.Fatalf("decoding %s: %v", payload, err)
+    }
+    return msg
+}
+
+func TestWSSessionProgress(t *testing.T) {
+    jobs := NewJobManager(NewEventBus(64, 100), 100, 1, 2)
+    started := make(chan string, 1)
+    release := make(chan struct{})
+    blocker, _ := jobs.Start(context.Background(), JobSpec{Name: "blocker"}, blockingJob("blocker", started, release))
+    <-started
+    
+    server, client := net.Pipe()
+    defer client.Close()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    ws := &wsSession{
+        server:   &Server{jobs: jobs},
+        conn:     &wsConn{conn: server},
+        ctx:      ctx,
+        inflight: make(map[string]context.CancelFunc),
+    }
+    
+    proceed := make(chan struct{})
+    ws.start("7", JobSpec{Kind: "test", Name: "smoke"}, func(ctx context.Context) map[string]interface{} {
+        <-proceed
+        job := jobFromContext(ctx)
+        job.appendLog("test-connection", "stdout", "line one")
+        job.appendLog("test-connection", "stdout", "line two")
+        return map[string]interface{}{"success": true, "status": InvocationOK}
+    })
+    
+    progress := func(want string) {
+        t.Helper()
+        msg := readServerMessage(t, client)
+        data, _ := json.Marshal(msg.Progress)
+        if msg.ID != "7" || msg.Type != "progress" || !strings.Contains(string(data), want) {
+            t.Fatalf("got %s %s %s, want progress with %s", msg.ID, msg.Type, data, want)
+        }
+    }
+    progress(`"queue_position":1,"state":"queued"`)
+    close(release)
+    waitDone(t, blocker)
+    progress(`"state":"running"`)
+    close(proceed)
+    progress(`"line":"line one"`)
+    progress(`"line":"line two"`)
+    
+    msg := readServerMessage(t, client)
+    if result, _ := msg.Result.(map[string]interface{}); msg.ID != "7" || msg.Type != "result" || result["status"] != InvocationOK {
+        t.Errorf("final message: %+v", msg)
+    }
+}
+
+func TestModuleAgentID(t *testing.T) {
+    tests := map[string]string{
+        `{"agentId": "code-1712345678901", "status": "ready"}`: "code-1712345678901",
+        `{"agent_id": "review-42"}`:                             "review-42",
+        `{"name": "coder"}`:                                     "",
+        "CodeAgent initialized\nAgent ID: code-17":             "code-17",
+        `agent_id="perf-9"`:                                     "perf-9",
+        "Agent coder (code) initialized":                       "",
+    }
+    for output, want := range tests {
+        if got := moduleAgentID(output); got != want {
+            t.Errorf("moduleAgentID(%q) = %q, want %q", output, got, want)
+        }
+    }
+}
+
+// TestAgentFollowUpCalls checks that the calls made for an agent carry the
+// ID the module knows it by
+func TestAgentFollowUpCalls(t *testing.T) {
+    tests := []struct {
+        name   string
+        output string
+        id     string
+    }{
+        {name: "keyed on the name", output: "Agent coder (code) initialized", id: "coder"},
+        {name: "ID from the output", output: "Agent ID: code-17\nCodeAgent initialized", id: "code-17"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, runner := newTestServer(t)
+            runner.responses["create-code-agent"] = FakeResponse{Output: tt.output}
+            mux := server.routes()
+            
+            rec := httptest.NewRecorder()
+            mux.ServeHTTP(rec, httptest.NewRequest("POST", "/api/agents?wait=true", strings.NewReader(`{"name": "coder", "type": "code"}`)))
+            if !strings.Contains(rec.Body.String(), `"id":"`+tt.id+`"`) {
+                t.Fatalf("create answered %s", rec.Body)
+            }
+            
+            rec = httptest.NewRecorder()
+            mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/agents/"+tt.id+"/metrics", nil))
+            if rec.Code != http.StatusOK {
+                t.Fatalf("metrics answered %d %s", rec.Code, rec.Body)
+            }
+            invocations := runner.Invocations()
+            last := invocations[len(invocations)-1]
+            if last.Function != "get-agent-metrics" || strings.Join(last.Args, " ") != "--agent-id "+tt.id {
+                t.Errorf("metrics called %s %v", last.Function, last.Args)
+            }
+        })
+    }
+    
+    server, _ := newTestServer(t)
+    rec := httptest.NewRecorder()
+    server.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/agents", strings.NewReader(`{"name": "../x", "type": "code"}`)))
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("invalid name answered %d %s", rec.Code, rec.Body)
+    }
+}
+
+func TestAgentCallsNeedAWorker(t *testing.T) {
+    server, runner := newTestServer(t)
+    if err := server.agents.Add(Agent{ID: "coder", Name: "coder", Type: "code", Function: "create-code-agent"}); err != nil {
+        t.Fatal(err)
+    }
+    mux := server.routes()
+    
+    // Both workers busy and the queue full
+    started := make(chan string, 6)
+    release := make(chan struct{})
+    var jobs []*Job
+    for i := 0; i < 6; i++ {
+        job, err := server.jobs.Start(context.Background(), JobSpec{Name: "busy"}, blockingJob("busy", started, release))
+        if err != nil {
+            t.Fatal(err)
+        }
+        jobs = append(jobs, job)
+    }
+    <-started
+    <-started
+    
+    requests := []*http.Request{
+        httptest.NewRequest("GET", "/api/agents/coder/metrics", nil),
+        httptest.NewRequest("PUT", "/api/agents/coder/memory", strings.NewReader(`{"key": "goal", "value": "ship"}`)),
+    }
+    for _, req := range requests {
+        rec := httptest.NewRecorder()
+        mux.ServeHTTP(rec, req)
+        if rec.Code != http.StatusTooManyRequests {
+            t.Errorf("%s %s with the queue full answered %d %s", req.Method, req.URL.Path, rec.Code, rec.Body)
+        }
+    }
+    if invocations := runner.Invocations(); len(invocations) != 0 {
+        t.Errorf("called the module without a worker: %+v", invocations)
+    }
+    
+    close(release)
+    for _, job := range jobs {
+        waitDone(t, job)
+    }
+    rec := httptest.NewRecorder()
+    mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/agents/coder/metrics", nil))
+    if rec.Code != http.StatusOK {
+        t.Errorf("metrics once workers are free answered %d %s", rec.Code, rec.Body)
+    }
+}
+
+func TestGraphQLRunnerUnnamedModule(t *testing.T) {
+    stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        if bytes.Contains(body, []byte("serve")) {
+            io.WriteString(w, `{"data": {"moduleSource": {"asModule": {"serve": null}}}}`)
+            return
+        }
+        // A schema without its name, as when introspection came back empty
+        io.WriteString(w, `{"data": {"moduleSource": {"asModule": {"name": "", "objects": [{"asObject": {"name": "", "functions": [{"name": "testConnection", "args": [], "returnType": {"kind": "STRING_KIND"}}]}}]}}}}`)
+    }))
+    defer stub.Close()
+    
+    runner := &GraphQLRunner{URL: stub.URL, Module: ".", Client: stub.Client()}
+    _, err := runner.Call(context.Background(), "test-connection")
+    if err == nil || !strings.Contains(err.Error(), "has no name") {
+        t.Errorf("Call on an unnamed module: %v", err)
+    }
+}
+
+func TestParseStatusDocument(t *testing.T) {
+    tests := []struct {
+        name   string
+        output string
+        agents int
+        err    string
+    }{
+        {name: "bare document", output: `{"agents": 5}`, agents: 5},
+        {name: "wrapped in log lines", output: "✔ connect {0.2s}\n{\"agents\": 3, \"components\": {\"a2a\": {\"status\": \"active\"}}}\ndone {ok}", agents: 3},
+        {name: "unknown fields", output: `{"agents": 2, "new_field": true}`, agents: 2},
+        {name: "wrong type", output: `{"agents": "five"}`, err: "invalid get-system-status document"},
+        {name: "no document", output: "Agents: 5\nSuccess Rate: 94%", err: "no JSON document"},
+        {name: "unterminated", output: `{"agents": 5`, err: "no JSON document"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            doc, err := parseStatusDocument([]byte(tt.output))
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Errorf("err = %v, want %q", err, tt.err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if doc.Agents == nil || *doc.Agents != tt.agents {
+                t.Errorf("agents = %v, want %d", doc.Agents, tt.agents)
+            }
+        })
+    }
+}
+
+func TestSystemStatus(t *testing.T) {
+    tests := []struct {
+        name     string
+        response FakeResponse
+        status   string
+        err      string
+    }{
+        {name: "module answers", response: FakeResponse{Output: `{"agents": 4, "generation": 2}`}, status: "CONNECTED"},
+        {name: "module fails", response: FakeResponse{Error: "exit status 1"}, status: "DEGRADED", err: "exit status 1"},
+        {name: "output does not parse", response: FakeResponse{Output: "System Status: HEALTHY"}, status: "DEGRADED", err: "no JSON document"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, runner := newTestServer(t)
+            runner.responses["get-system-status"] = tt.response
+            status := server.getRealSystemStatus(context.Background())
+            
+            if status.Status != tt.status || !status.Connected || !strings.Contains(status.Error, tt.err) || (tt.err == "") != (status.Error == "") {
+                t.Errorf("status %s connected %t error %q, want %s with %q", status.Status, status.Connected, status.Error, tt.status, tt.err)
+            }
+            for _, inv := range runner.Invocations() {
+                if inv.Function == "get-system-status" && len(inv.Args) != 0 {
+                    t.Errorf("get-system-status called with %v", inv.Args)
+                }
+            }
+        })
+    }
+}
+
+// drain returns the types of the events waiting on sub
+func drain(sub *Subscription) []string {
+    var types []string
+    for {
+        select {
+        case evt := <-sub.C:
+            types = append(types, evt.Type)
+        default:
+            return types
+        }
+    }
+}
+
+func TestPublishStatus(t *testing.T) {
+    server, _ := newTestServer(t)
+    sub := server.events.Subscribe(EventFilter{})
+    defer server.events.Unsubscribe(sub)
+    
+    up := SystemStatus{Status: "CONNECTED", Connected: true, Agents: 3}
+    down := SystemStatus{Status: "DISCONNECTED", Error: "no engine"}
+    steps := []struct {
+        status SystemStatus
+        events []string
+    }{
+        {up, []string{EventStatusUpdate}},
+        {up, nil},
+        {SystemStatus{Status: "CONNECTED", Connected: true, Agents: 4}, []string{EventStatusUpdate}},
+        {down, []string{EventConnectionLost, EventStatusUpdate}},
+        {down, nil},
+        {up, []string{EventConnectionRestored, EventStatusUpdate}},
+    }
+    for i, step := range steps {
+        server.publishStatus(step.status)
+        if got := drain(sub); !slices.Equal(got, step.events) {
+            t.Errorf("step %d published %v, want %v", i, got, step.events)
+        }
+    }
+}
+
+func TestRunAgentTask(t *testing.T) {
+    tests := []struct {
+        name     string
+        function string
+        response FakeResponse
+        retries  int
+        status   string
+        attempts int
+    }{
+        {"success", "execute-agent-with-context", FakeResponse{Output: "done"}, 2, InvocationOK, 1},
+        {"retried until out of retries", "execute-agent-with-context", FakeResponse{Error: "boom"}, 2, InvocationFailed, 3},
+        {"module retries, plain output", "execute-agent-with-retry", FakeResponse{Output: "Attempt 1 failed\nAttempt 2 succeeded"}, 0, InvocationOK, 1},
+        {"module retries, JSON output", "execute-agent-with-retry", FakeResponse{Output: `{"attempts": 3, "result": "done"}`}, 0, InvocationOK, 3},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, runner := newTestServer(t)
+            server.taskBackoff = time.Millisecond
+            runner.responses[tt.function] = tt.response
+            
+            result := server.runAgentTask(context.Background(), Agent{ID: "scanner", Name: "scanner"}, tt.function, []string{"--agent-id", "scanner"}, tt.retries)
+            if result["status"] != tt.status || result["attempts"] != tt.attempts {
+                t.Errorf("got %v after %v attempts, want %s after %d", result["status"], result["attempts"], tt.status, tt.attempts)
+            }
+            if calls := len(runner.Invocations()); calls != min(tt.attempts, tt.retries+1) {
+                t.Errorf("%d calls for %d attempts", calls, tt.attempts)
+            }
+        })
+    }
+    
+    t.Run("cancelled while backing off", func(t *testing.T) {
+        server, runner := newTestServer(t)
+        server.taskBackoff = time.Hour
+        runner.responses["execute-agent"] = FakeResponse{Error: "boom"}
+        
+        ctx, cancel := context.WithCancel(context.Background())
+        time.AfterFunc(10*time.Millisecond, cancel)
+        result := server.runAgentTask(ctx, Agent{ID: "scanner", Name: "scanner"}, "execute-agent", nil, 3)
+        if result["status"] != InvocationCancelled || result["attempts"] != 1 {
+            t.Errorf("got %v after %v attempts", result["status"], result["attempts"])
+        }
+    })
+}
+
+func TestAgentTaskDelay(t *testing.T) {
+    base := 100 * time.Millisecond
+    for n := 1; n <= 20; n++ {
+        full := agentTaskMaxBackoff
+        if n < 8 {
+            full = min(base<<(n-1), agentTaskMaxBackoff)
+        }
+        for range 20 {
+            if d := agentTaskDelay(base, n); d < full/2 || d > full {
+                t.Fatalf("retry %d waits %s, want %s to %s", n, d, full/2, full)
+            }
+        }
+    }
+}
+
+func TestPromWriteStatus(t *testing.T) {
+    tests := []struct {
+        status    string
+        connected string
+        simulated string
+    }{
+        {"CONNECTED", "1", "0"},
+        {"DEGRADED", "0", "0"},
+        {"DISCONNECTED", "0", "0"},
+        {"SIMULATED", "0", "1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.status, func(t *testing.T) {
+            var pw promWriter
+            pw.writeStatus(SystemStatus{Status: tt.status, Sources: unknownSources()})
+            out := pw.b.String()
+            for _, want := range []string{
+                "\nproactiva_dagger_connected " + tt.connected + "\n",
+                "\nproactiva_simulated " + tt.simulated + "\n",
+            } {
+                if !strings.Contains(out, want) {
+                    t.Errorf("missing %q in\n%s", strings.TrimSpace(want), out)
+                }
+            }
+            // Every other status field has an unknown source
+            if strings.Contains(out, "proactiva_agents") || strings.Contains(out, "proactiva_component_status") {
+                t.Errorf("unknown fields exported:\n%s", out)
+            }
+        })
+    }
+}
+
+func TestJobHandlerCancel(t *testing.T) {
+    server, _ := newTestServer(t)
+    started := make(chan string, 1)
+    release := make(chan struct{})
+    defer close(release)
+    
+    running, _ := server.jobs.Start(context.Background(), JobSpec{Name: "running"}, blockingJob("running", started, release))
+    <-started
+    cancel := func() *httptest.ResponseRecorder {
+        rec := httptest.NewRecorder()
+        server.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/jobs/"+running.ID+"/cancel", nil))
+        return rec
+    }
+    
+    if rec := cancel(); rec.Code != http.StatusOK {
+        t.Errorf("cancelling a running job: %d %s", rec.Code, rec.Body)
+    }
+    waitDone(t, running)
+    if rec := cancel(); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "already cancelled") {
+        t.Errorf("cancelling a finished job: %d %s", rec.Code, rec.Body)
+    }
+}
+
+func TestStatusCacheRefresh(t *testing.T) {
+    synctest.Test(t, func(t *testing.T) {
+        var fetches atomic.Int32
+        release := make(chan struct{})
+        cache := NewStatusCache(func(ctx context.Context) SystemStatus {
+            n := fetches.Add(1)
+            <-release
+            return SystemStatus{Agents: int(n)}
+        }, time.Minute)
+        var updates atomic.Int32
+        cache.OnUpdate(func(SystemStatus) { updates.Add(1) })
+        
+        results := make(chan SystemStatus, 3)
+        for range 3 {
+            go func() { results <- cache.Refresh(context.Background()) }()
+        }
+        synctest.Wait()
+        
+        // A caller that gives up returns the old snapshot without waiting
+        ctx, cancel := context.WithCancel(context.Background())
+        cancel()
+        if status := cache.Refresh(ctx); status.Agents != 0 {
+            t.Errorf("abandoned refresh returned %+v", status)
+        }
+        
+        close(release)
+        for range 3 {
+            if status := <-results; status.Agents != 1 {
+                t.Errorf("refresh returned fetch %d", status.Agents)
+            }
+        }
+        if n := fetches.Load(); n != 1 {
+            t.Errorf("%d fetches for concurrent refreshes", n)
+        }
+        if n := updates.Load(); n != 1 {
+            t.Errorf("%d updates for one fetch", n)
+        }
+        
+        // Get serves the snapshot and its age without fetching again
+        time.Sleep(2 * time.Second)
+        if status := cache.Get(context.Background()); status.Agents != 1 || status.SnapshotAgeMS != 2000 || fetches.Load() != 1 {
+            t.Errorf("Get = %+v after %d fetches", status, fetches.Load())
+        }
+    })
+}
+
+func TestMetricsStore(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "metrics.jsonl")
+    store, err := OpenMetricsStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    now := time.Now().Truncate(time.Minute)
+    samples := []struct {
+        age  time.Duration
+        data MetricsData
+    }{
+        {2 * time.Hour, MetricsData{SuccessRate: 0.1, TaskCount: 9}},
+        {10 * time.Minute, MetricsData{SuccessRate: 0.4, Fitness: 0.5, TaskCount: 1}},
+        {10*time.Minute - time.Second, MetricsData{SuccessRate: 0.6, Fitness: 0.7, TaskCount: 2}},
+        {time.Minute, MetricsData{SuccessRate: 0.9, TaskCount: 4}},
+    }
+    for _, sample := range samples {
+        if err := store.Append(now.Add(-sample.age), sample.data); err != nil {
+            t.Fatal(err)
+        }
+    }
+    
+    if got := store.Query(now.Add(-3*time.Hour), now, 0); len(got) != 4 {
+        t.Errorf("raw query returned %d samples, want 4", len(got))
+    }
+    // The two samples ten minutes ago share a bucket and are averaged
+    got := store.Query(now.Add(-30*time.Minute), now, 5*time.Minute)
+    if len(got) != 2 || got[0].SuccessRate != 0.5 || got[0].Fitness != 0.6 || got[0].TaskCount != 2 {
+        t.Errorf("bucketed query = %+v", got)
+    }
+    
+    // Compaction forgets the sample past retention, in memory and on disk,
+    // and appending still works afterwards
+    if err := store.Compact(); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.Append(now, MetricsData{SuccessRate: 1}); err != nil {
+        t.Fatal(err)
+    }
+    
+    // A torn line from a crash does not stop the store from loading
+    file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    file.WriteString(`{"timestamp": "20`)
+    file.Close()
+    
+    reopened, err := OpenMetricsStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := reopened.Query(now.Add(-3*time.Hour), now, 0); len(got) != 4 || got[0].SuccessRate != 0.4 {
+        t.Errorf("reopened store holds %+v", got)
+    }
+}
+
+func TestPromRegistry(t *testing.T) {
+    prom := NewPromRegistry()
+    prom.ObserveDagger("test-connection", InvocationOK, 300*time.Millisecond)
+    prom.ObserveDagger("test-connection", InvocationOK, 3*time.Second)
+    prom.ObserveDagger("run-benchmark", InvocationTimedOut, 700*time.Second)
+    handler := prom.Instrument("/api/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "unknown job", http.StatusNotFound)
+    })
+    handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/jobs/job-nope", nil))
+    
+    var pw promWriter
+    prom.writeCounters(&pw)
+    out := pw.b.String()
+    for _, want := range []string{
+        "# TYPE proactiva_dagger_invocations_total counter\n" +
+            "proactiva_dagger_invocations_total{function=\"run-benchmark\",status=\"timed_out\"} 1\n" +
+            "proactiva_dagger_invocations_total{function=\"test-connection\",status=\"ok\"} 2\n",
+        "proactiva_dagger_invocation_duration_seconds_bucket{function=\"test-connection\",le=\"0.1\"} 0\n" +
+            "proactiva_dagger_invocation_duration_seconds_bucket{function=\"test-connection\",le=\"0.5\"} 1\n",
+        "proactiva_dagger_invocation_duration_seconds_bucket{function=\"test-connection\",le=\"5\"} 2\n",
+        "proactiva_dagger_invocation_duration_seconds_bucket{function=\"run-benchmark\",le=\"600\"} 0\n" +
+            "proactiva_dagger_invocation_duration_seconds_bucket{function=\"run-benchmark\",le=\"+Inf\"} 1\n" +
+            "proactiva_dagger_invocation_duration_seconds_sum{function=\"run-benchmark\"} 700\n" +
+            "proactiva_dagger_invocation_duration_seconds_count{function=\"run-benchmark\"} 1\n",
+        "proactiva_dagger_invocation_duration_seconds_sum{function=\"test-connection\"} 3.3\n",
+        "proactiva_http_requests_total{route=\"/api/jobs/{id}\",method=\"GET\",code=\"404\"} 1\n",
+        "# TYPE proactiva_http_request_duration_seconds histogram\n",
+    } {
+        if !strings.Contains(out, want) {
+            t.Errorf("missing\n%s\nin\n%s", want, out)
+        }
+    }
+    
+    var escaped promWriter
+    escaped.sample("m", []string{"label", "a \"quoted\\path\"\n"}, 1)
+    if got, want := escaped.b.String(), `m{label="a \"quoted\\path\"\n"} 1`+"\n"; got != want {
+        t.Errorf("escaped sample = %q, want %q", got, want)
+    }
+}
+
+func TestPromHandler(t *testing.T) {
+    server, _ := newTestServer(t)
+    rec := httptest.NewRecorder()
+    server.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    
+    if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+        t.Errorf("Content-Type = %q", ct)
+    }
+    for _, want := range []string{
+        "\nproactiva_dagger_connected 1\n",
+        "\nproactiva_jobs_running 0\n",
+        "\nproactiva_jobs_queued{priority=\"background\"} 0\n",
+        "\nproactiva_dagger_invocations_total{function=\"get-system-status\",status=\"ok\"} 1\n",
+    } {
+        if !strings.Contains(rec.Body.String(), want) {
+            t.Errorf("missing %q in\n%s", strings.TrimSpace(want), rec.Body)
+        }
+    }
+}
+
+func TestTracerExport(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "traces.jsonl")
+    file, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    // No export loop: the test drains spans itself
+    tracer := &Tracer{service: "test", file: file, spans: make(chan *Span, 16)}
+    
+    const traceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+    handler := tracer.Trace("/api/test", func(w http.ResponseWriter, r *http.Request) {
+        _, span := tracer.Start(r.Context(), "dagger call test-connection", SpanKindClient, "")
+        span.SetAttribute("dagger.args", []string{"--verbose"})
+        span.SetError(errors.New("exit status 1"))
+        span.End()
+        w.WriteHeader(http.StatusBadGateway)
+    })
+    req := httptest.NewRequest("POST", "/api/test", nil)
+    req.Header.Set("traceparent", traceparent)
+    handler(httptest.NewRecorder(), req)
+    
+    batch := []*Span{<-tracer.spans, <-tracer.spans}
+    if err := tracer.export(batch); err != nil {
+        t.Fatal(err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    var doc struct {
+        ResourceSpans []struct {
+            ScopeSpans []struct {
+                Spans []struct {
+                    TraceID      string `json:"traceId"`
+                    SpanID       string `json:"spanId"`
+                    ParentSpanID string `json:"parentSpanId"`
+                    Name         string `json:"name"`
+                    Kind         int    `json:"kind"`
+                    Attributes   []struct {
+                        Key   string                 `json:"key"`
+                        Value map[string]interface{} `json:"value"`
+                    } `json:"attributes"`
+                    Status struct {
+                        Code    int    `json:"code"`
+                        Message string `json:"message"`
+                    } `json:"status"`
+                } `json:"spans"`
+            } `json:"scopeSpans"`
+        } `json:"resourceSpans"`
+    }
+    if err := json.Unmarshal(bytes.TrimSpace(data), &doc); err != nil {
+        t.Fatalf("export is not one OTLP/JSON line: %v\n%s", err, data)
+    }
+    spans := doc.ResourceSpans[0].ScopeSpans[0].Spans
+    if len(spans) != 2 {
+        t.Fatalf("exported %d spans", len(spans))
+    }
+    call, server := spans[0], spans[1]
+    
+    // The server span joins the caller's trace and the call nests under it
+    if server.TraceID != "0af7651916cd43dd8448eb211c80319c" || server.ParentSpanID != "b7ad6b7169203331" || server.Name != "POST /api/test" {
+        t.Errorf("server span = %+v", server)
+    }
+    if call.TraceID != server.TraceID || call.ParentSpanID != server.SpanID || call.Kind != SpanKindClient {
+        t.Errorf("call span = %+v", call)
+    }
+    if call.Status.Code != SpanStatusError || call.Status.Message != "exit status 1" {
+        t.Errorf("call status = %+v", call.Status)
+    }
+    if server.Status.Code != SpanStatusError {
+        t.Errorf("a 502 left the server span %+v", server.Status)
+    }
+    var args, code bool
+    for _, attr := range call.Attributes {
+        args = args || attr.Key == "dagger.args" && attr.Value["arrayValue"] != nil
+    }
+    for _, attr := range server.Attributes {
+        code = code || attr.Key == "http.response.status_code" && attr.Value["intValue"] == "502"
+    }
+    if !args || !code {
+        t.Errorf("attributes: call %+v, server %+v", call.Attributes, server.Attributes)
+    }
+}
+
+// dialWS opens /api/ws on ts with origin, returning the connection and the
+// handshake response
+func dialWS(t *testing.T, ts *httptest.Server, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+    t.Helper()
+    conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    
+    req, _ := http.NewRequest("GET", ts.URL+"/api/ws", nil)
+    req.Header.Set("Upgrade", "websocket")
+    req.Header.Set("Connection", "Upgrade")
+    req.Header.Set("Sec-WebSocket-Version", "13")
+    req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+    if origin != "" {
+        req.Header.Set("Origin", origin)
+    }
+    if err := req.Write(conn); err != nil {
+        t.Fatal(err)
+    }
+    reader := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(reader, req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return conn, reader, resp
+}
+
+func TestWSHandshake(t *testing.T) {
+    server, _ := newTestServer(t)
+    ts := httptest.NewServer(server.routes())
+    defer ts.Close()
+    
+    // Any page can open a WebSocket to localhost, so the origin is checked
+    if _, _, resp := dialWS(t, ts, "https://evil.example"); resp.StatusCode != http.StatusForbidden {
+        t.Errorf("foreign origin: %s", resp.Status)
+    }
+    
+    conn, reader, resp := dialWS(t, ts, ts.URL)
+    if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+        t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+    }
+    conn.Write(maskedFrame(true, wsText, `{"id": "1", "method": "status"}`))
+    msg := readServerMessage(t, reader)
+    if result, _ := msg.Result.(map[string]interface{}); msg.ID != "1" || msg.Type != "result" || result["connected"] != true {
+        t.Errorf("status reply: %+v", msg)
+    }
+    conn.Write(maskedFrame(true, wsText, `{"id": "2", "method": "nope"}`))
+    if msg := readServerMessage(t, reader); msg.Error == nil || msg.Error.Code != wsMethodNotFound {
+        t.Errorf("unknown method reply: %+v", msg)
+    }
+}
+
+func TestJobLogTrimming(t *testing.T) {
+    job := &Job{done: make(chan struct{}), logNotify: make(chan struct{})}
+    
+    _, notify, finished := job.LogsAfter(0)
+    job.appendLog("run-benchmark", "stdout", "first")
+    select {
+    case <-notify:
+    default:
+        t.Error("appending a line did not wake followers")
+    }
+    if finished {
+        t.Error("a running job reported finished")
+    }
+    
+    // Lines in the slack are retained but no longer served
+    for i := 1; i < maxJobLogLines+jobLogSlack; i++ {
+        job.appendLog("run-benchmark", "stdout", strconv.Itoa(i))
+    }
+    lines, _, _ := job.LogsAfter(0)
+    if len(lines) != maxJobLogLines || lines[0].Seq != jobLogSlack+1 {
+        t.Errorf("served %d lines from %d", len(lines), lines[0].Seq)
+    }
+    if len(job.logs) != maxJobLogLines+jobLogSlack {
+        t.Errorf("trimmed early to %d lines", len(job.logs))
+    }
+    
+    // One more line trims the slack in one go
+    job.appendLog("run-benchmark", "stderr", "last")
+    if len(job.logs) != maxJobLogLines {
+        t.Errorf("kept %d lines after trimming", len(job.logs))
+    }
+    lines, _, _ = job.LogsAfter(maxJobLogLines + jobLogSlack - 1)
+    if len(lines) != 2 || lines[1].Line != "last" || lines[1].Stream != "stderr" || lines[1].Seq != maxJobLogLines+jobLogSlack+1 {
+        t.Errorf("tail after trimming = %+v", lines)
+    }
+    
+    close(job.done)
+    if _, _, finished := job.LogsAfter(0); !finished {
+        t.Error("a finished job reported running")
+    }
+}
+
+// storedRun is a finished job created age ago
+func storedRun(id, kind, name, state string, age time.Duration) JobView {
+    return JobView{
+        ID:        id,
+        Kind:      kind,
+        Name:      name,
+        State:     state,
+        CreatedAt: time.Now().Add(-age).Format(time.RFC3339Nano),
+    }
+}
+
+func TestRunStore(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "runs.jsonl")
+    store, err := OpenRunStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    // Jobs finish out of order; records are still sorted by creation
+    for _, run := range []JobView{
+        storedRun("job-old", "test", "smoke", JobSucceeded, 2*time.Hour),
+        storedRun("job-c", "test", "smoke", JobFailed, time.Minute),
+        storedRun("job-a", "test", "smoke", JobSucceeded, 3*time.Minute),
+        storedRun("job-b", "command", "evolve", JobSucceeded, 2*time.Minute),
+    } {
+        if err := store.Append(run); err != nil {
+            t.Fatal(err)
+        }
+    }
+    
+    ids := func(runs []JobView) []string {
+        var out []string
+        for _, run := range runs {
+            out = append(out, run.ID)
+        }
+        return out
+    }
+    tests := []struct {
+        name  string
+        query RunQuery
+        want  []string
+        total int
+    }{
+        {"newest first", RunQuery{Limit: 10}, []string{"job-c", "job-b", "job-a", "job-old"}, 4},
+        {"by kind and name", RunQuery{Kind: "test", Name: "smoke", Limit: 10}, []string{"job-c", "job-a", "job-old"}, 3},
+        {"by status", RunQuery{Status: JobFailed, Limit: 10}, []string{"job-c"}, 1},
+        {"since", RunQuery{From: time.Now().Add(-150 * time.Second), Limit: 10}, []string{"job-c", "job-b"}, 2},
+        {"paged", RunQuery{Limit: 2, Offset: 1}, []string{"job-b", "job-a"}, 4},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            runs, total := store.Query(tt.query)
+            if !slices.Equal(ids(runs), tt.want) || total != tt.total {
+                t.Errorf("got %v of %d, want %v of %d", ids(runs), total, tt.want, tt.total)
+            }
+        })
+    }
+    
+    if page := store.Page(RunQuery{Limit: 2, Offset: 1}); page["next_offset"] != 3 {
+        t.Errorf("page = %v", page)
+    }
+    if page := store.Page(RunQuery{Limit: 2, Offset: 2}); page["next_offset"] != nil {
+        t.Errorf("last page has next_offset %v", page["next_offset"])
+    }
+    if run, ok := store.Get("job-b"); !ok || run.Name != "evolve" {
+        t.Errorf("Get(job-b) = %+v, %v", run, ok)
+    }
+    
+    // Compaction drops what is past retention from memory and disk
+    if err := store.Compact(); err != nil {
+        t.Fatal(err)
+    }
+    reopened, err := OpenRunStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, s := range []*RunStore{store, reopened} {
+        if runs, _ := s.Query(RunQuery{Limit: 10}); !slices.Equal(ids(runs), []string{"job-c", "job-b", "job-a"}) {
+            t.Errorf("after compaction: %v", ids(runs))
+        }
+    }
+}
+
+func TestRunTestSuiteFallback(t *testing.T) {
+    tests := []struct {
+        name      string
+        steps     string
+        responses map[string]FakeResponse
+        success   bool
+        message   string
+        ran       []string
+        fallbacks int
+    }{
+        {
+            name:      "step passes",
+            steps:     `[{"function": "send-a-2-amessage", "message": "sent", "fallback": [{"function": "test-connection"}]}]`,
+            responses: map[string]FakeResponse{"send-a-2-amessage": {Output: "ok"}},
+            success:   true, message: "sent",
+            ran:       []string{"send-a-2-amessage"},
+        },
+        {
+            name:  "failed call recovered by its fallback",
+            steps: `[{"function": "send-a-2-amessage", "message": "sent", "fallback": [{"function": "test-connection", "message": "only connected"}]}, {"function": "get-system-status"}]`,
+            responses: map[string]FakeResponse{
+                "send-a-2-amessage": {Error: "exit status 1"},
+                "test-connection":   {Output: "connection OK"},
+                "get-system-status": {Output: "{}"},
+            },
+            success: true, message: "only connected",
+            ran:       []string{"send-a-2-amessage", "test-connection", "get-system-status"},
+            fallbacks: 1,
+        },
+        {
+            name:  "failed assertion and failed fallback",
+            steps: `[{"function": "test-connection", "expect": [{"type": "contains", "value": "healthy"}], "fallback": [{"function": "get-system-status"}]}, {"function": "get-agent-metrics"}]`,
+            responses: map[string]FakeResponse{
+                "test-connection":   {Output: "connection OK"},
+                "get-system-status": {Error: "exit status 1"},
+            },
+            success:   false, message: "Suite failed",
+            ran:       []string{"test-connection", "get-system-status"},
+            fallbacks: 1,
+        },
+        {
+            name:      "failure without a fallback stops the suite",
+            steps:     `[{"function": "test-connection"}, {"function": "get-system-status"}]`,
+            responses: map[string]FakeResponse{"test-connection": {Error: "exit status 1"}},
+            success:   false, message: "Suite failed",
+            ran:       []string{"test-connection"},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, runner := newTestServer(t)
+            runner.responses = tt.responses
+            var suite TestSuite
+            if err := json.Unmarshal([]byte(`{"name": "fallback", "message": "Suite passed", "failure_message": "Suite failed", "steps": `+tt.steps+`}`), &suite); err != nil {
+                t.Fatal(err)
+            }
+            if err := suite.validate(); err != nil {
+                t.Fatal(err)
+            }
+            
+            result := server.runTestSuite(context.Background(), &suite)
+            message, _ := result["message"].(string)
+            if !tt.success {
+                message, _ = result["error"].(string)
+            }
+            if result["success"] != tt.success || !strings.HasPrefix(message, tt.message) {
+                t.Errorf("got success %v, %q; want %v, %q", result["success"], message, tt.success, tt.message)
+            }
+            
+            var ran []string
+            fallbacks := 0
+            for _, step := range result["steps"].([]StepResult) {
+                ran = append(ran, step.Function)
+                if step.Fallback {
+                    fallbacks++
+                }
+            }
+            if !slices.Equal(ran, tt.ran) || fallbacks != tt.fallbacks {
+                t.Errorf("ran %v with %d fallbacks, want %v with %d", ran, fallbacks, tt.ran, tt.fallbacks)
+            }
+        })
+    }
+}
+
+func TestLoadTestSuites(t *testing.T) {
+    dir := t.TempDir()
+    write := func(name, content string) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        return path
+    }
+    
+    tests := []struct {
+        name    string
+        content string
+        err     string
+    }{
+        {"valid", testSuitesJSON, ""},
+        {"not JSON", `suites:`, "invalid suites file"},
+        {"no steps", `{"suites": [{"name": "empty"}]}`, "has no steps"},
+        {"bad priority", `{"suites": [{"name": "p", "priority": "urgent", "steps": [{"function": "f"}]}]}`, "invalid priority"},
+        {"fallback without a function", `{"suites": [{"name": "f", "steps": [{"function": "f", "fallback": [{}]}]}]}`, "has no function"},
+        {"duplicate", `{"suites": [{"name": "d", "steps": [{"function": "f"}]}, {"name": "d", "steps": [{"function": "f"}]}]}`, "duplicate suite"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            suites, err := LoadTestSuites(write("suites.json", tt.content))
+            if tt.err == "" {
+                if err != nil || len(suites) != 1 || suites[0].Priority != PriorityInteractive || suites[0].Steps[0].Name != "test-connection" {
+                    t.Errorf("got %v, %v", suites, err)
+                }
+            } else if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Errorf("err = %v, want %q", err, tt.err)
+            }
+        })
+    }
+    
+    // Without a suites file the server still starts, with no suites
+    if _, err := LoadTestSuites(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("missing file: %v", err)
+    }
+    server, err := NewServer(NewFakeRunner(defaultFakeResponses()), ServerConfig{
+        DataDir:    dir,
+        QueueSize:  1,
+        TestSuites: filepath.Join(dir, "missing.json"),
+    })
+    if err != nil {
+        t.Fatalf("NewServer without a suites file: %v", err)
+    }
+    if suites := server.suites.All(); len(suites) != 0 {
+        t.Errorf("serving %d suites", len(suites))
+    }
+}
+
+func TestShippedSuitesPass(t *testing.T) {
+    suites, err := LoadTestSuites("test-suites.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    runners := map[string]struct {
+        runner   DaggerRunner
+        simulate bool
+    }{
+        "fake":      {NewFakeRunner(defaultFakeResponses()), false},
+        "simulated": {NewSimulatedRunner(), true},
+    }
+    for name, r := range runners {
+        server, err := NewServer(r.runner, ServerConfig{
+            Timeouts:  defaultDaggerTimeouts(),
+            Simulate:   r.simulate,
+            DataDir:    t.TempDir(),
+            QueueSize:  1,
+            TestSuites: "test-suites.json",
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, suite := range suites {
+            t.Run(name+"/"+suite.Name, func(t *testing.T) {
+                result := server.runTestSuite(context.Background(), suite)
+                if result["success"] != true {
+                    t.Errorf("failed: %v (steps %+v)", result["error"], result["steps"])
+                }
+                if result["simulated"] != r.simulate {
+                    t.Errorf("simulated = %v", result["simulated"])
+                }
+            })
+        }
+    }
+}
+
+// cliSuitesJSON is the suites file the CLI tests run
+const cliSuitesJSON = `{"suites": [
+    {"name": "pass", "steps": [{"function": "test-connection"}]},
+    {"name": "fail", "steps": [{"function": "broken"}]},
+    {"name": "slow", "steps": [{"function": "run-slow", "timeout": "20ms"}]}
+]}`
+
+func TestCLIExitCodes(t *testing.T) {
+    tests := []struct {
+        name      string
+        run       func(ServerConfig, []string) int
+        args      []string
+        responses map[string]FakeResponse
+        code      int
+    }{
+        {"status", cliStatus, []string{"--format", "json"}, nil, exitOK},
+        {"status degraded", cliStatus, nil, map[string]FakeResponse{"get-system-status": {Error: "exit status 1"}}, exitFailed},
+        {"status help", cliStatus, []string{"-h"}, nil, exitOK},
+        {"status unknown flag", cliStatus, []string{"--nope"}, nil, exitUsage},
+        {"status bad format", cliStatus, []string{"--format", "xml"}, nil, exitUsage},
+        {"test passes", cliTest, []string{"pass", "--format", "tap"}, nil, exitOK},
+        {"test fails", cliTest, []string{"fail"}, nil, exitFailed},
+        {"test times out", cliTest, []string{"slow"}, nil, exitTimedOut},
+        {"test unknown suite", cliTest, []string{"nope"}, nil, exitUsage},
+        {"test without a suite", cliTest, nil, nil, exitUsage},
+        {"exec", cliExec, []string{"initialize"}, nil, exitOK},
+        {"exec fails", cliExec, []string{"initialize"}, map[string]FakeResponse{"test-connection": {Error: "exit status 1"}}, exitFailed},
+        {"exec unknown command", cliExec, []string{"nope"}, nil, exitUsage},
+        {"exec unknown argument", cliExec, []string{"initialize", "--arg", "nope=1"}, nil, exitUsage},
+        {"runs list", cliRuns, []string{"list", "--kind", "test"}, nil, exitOK},
+        {"runs unknown subcommand", cliRuns, []string{"show"}, nil, exitUsage},
+        {"runs bad filter", cliRuns, []string{"list", "--limit", "-1"}, nil, exitUsage},
+    }
+    
+    // The subcommands print to the process's stdout and stderr
+    devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout, stderr := os.Stdout, os.Stderr
+    os.Stdout, os.Stderr = devnull, devnull
+    defer func() {
+        os.Stdout, os.Stderr = stdout, stderr
+        devnull.Close()
+    }()
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            responses := map[string]FakeResponse{
+                "test-connection":   {Output: "connection OK"},
+                "get-system-status": {Output: `{"agents": 1}`},
+                "broken":            {Error: "exit status 1"},
+                "run-slow":          {Output: "done", DelayMS: 5000},
+            }
+            for name, response := range tt.responses {
+                responses[name] = response
+            }
+            fixtures, _ := json.Marshal(responses)
+            files := map[string]string{"fixtures.json": string(fixtures), "suites.json": cliSuitesJSON}
+            for name, content := range files {
+                if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            t.Setenv("PROACTIVA_DAGGER_RUNNER", "fake")
+            t.Setenv("PROACTIVA_DAGGER_FIXTURES", filepath.Join(dir, "fixtures.json"))
+            
+            code := tt.run(ServerConfig{
+                Timeouts:      defaultDaggerTimeouts(),
+                DataDir:       dir,
+                RunsRetention: time.Hour,
+                MaxConcurrent: 1,
+                QueueSize:     1,
+                TestSuites:    filepath.Join(dir, "suites.json"),
+                EventLog:      filepath.Join(dir, "events.jsonl"),
+            }, tt.args)
+            if code != tt.code {
+                t.Errorf("exit code %d, want %d", code, tt.code)
+            }
+            // The event log belongs to serve; a subcommand sharing the data
+            // directory must not write to it
+            if _, err := os.Stat(filepath.Join(dir, "events.jsonl")); !errors.Is(err, os.ErrNotExist) {
+                t.Errorf("subcommand touched the event log: %v", err)
+            }
+        })
+    }
+    
+    if code := jobExitCode(JobCancelled); code != exitCancelled {
+        t.Errorf("a cancelled job exits %d", code)
+    }
+}
+
+func TestRunStoreShared(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "runs.jsonl")
+    // server and cli stand in for two processes sharing the data directory
+    server, err := OpenRunStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cli, err := OpenRunStore(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    server.Append(storedRun("job-old", "test", "smoke", JobSucceeded, 2*time.Hour))
+    cli.Append(storedRun("job-cli", "test", "smoke", JobSucceeded, time.Minute))
+    if _, ok := server.Get("job-cli"); !ok {
+        t.Error("server did not pick up the CLI's record")
+    }
+    
+    // After the server compacts, the CLI reads the new file from the start
+    // and its appends land in it
+    if err := server.Compact(); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := cli.Get("job-old"); ok {
+        t.Error("CLI still serves a compacted record")
+    }
+    cli.Append(storedRun("job-after", "command", "evolve", JobSucceeded, 0))
+    for _, store := range []*RunStore{server, cli} {
+        if _, total := store.Query(RunQuery{Limit: 10}); total != 2 {
+            t.Errorf("%d records after compaction, want 2", total)
+        }
+    }
+    
+    // Appends wait while another process holds the lock
+    unlock, err := lockFile(path + ".lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    appended := make(chan error)
+    go func() { appended <- cli.Append(storedRun("job-locked", "test", "smoke", JobSucceeded, 0)) }()
+    select {
+    case err := <-appended:
+        t.Fatalf("Append did not wait for the lock: %v", err)
+    case <-time.After(50 * time.Millisecond):
+    }
+    unlock()
+    if err := <-appended; err != nil {
+        t.Fatal(err)
+    }
+    
+    // A lock left behind by a process that died is broken
+    if err := os.WriteFile(path+".lock", nil, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    stale := time.Now().Add(-2 * staleLockAge)
+    os.Chtimes(path+".lock", stale, stale)
+    if err := server.Append(storedRun("job-stale", "test", "smoke", JobSucceeded, 0)); err != nil {
+        t.Fatal(err)
+    }
+    if _, total := cli.Query(RunQuery{Limit: 10}); total != 4 {
+        t.Errorf("%d records, want 4", total)
+    }
+}
+
+func TestCommandFlags(t *testing.T) {
+    commands := NewCommands(builtinCommands())
+    tests := []struct {
+        command string
+        args    string
+        flags   []string
+        err     string
+    }{
+        {"evolve", `{}`, nil, ""},
+        {"evolve", `{"mutation-rate": 0.2, "elitism-count": 2}`, []string{"--mutation-rate", "0.2", "--elitism-count", "2"}, ""},
+        {"evolve", `{"mutation-rate": 2}`, nil, "above the maximum"},
+        {"evolve", `{"elitism-count": 1.5}`, nil, "want an integer"},
+        {"evolve", `{"mutation-rate": "high"}`, nil, "want a number"},
+        {"export", `{}`, []string{"--format", "json"}, ""},
+        {"snapshot", `{}`, nil, `missing required argument "name"`},
+        {"snapshot", `{"name": "before", "force": true}`, nil, `unknown argument "force"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.command+" "+tt.args, func(t *testing.T) {
+            var args map[string]interface{}
+            json.Unmarshal([]byte(tt.args), &args)
+            flags, err := commands.Get(tt.command).Flags(args)
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Errorf("err = %v, want %q", err, tt.err)
+                }
+            } else if err != nil || !slices.Equal(flags, tt.flags) {
+                t.Errorf("got %q, %v; want %q", flags, err, tt.flags)
+            }
+        })
+    }
+}
+
+func TestCommandsRunWithoutDagger(t *testing.T) {
+    runners := map[string]DaggerRunner{
+        "fake":      NewFakeRunner(defaultFakeResponses()),
+        "simulated": NewSimulatedRunner(),
+    }
+    args := map[string]map[string]interface{}{
+        "learn":    {"experience": `{"task": "deployment", "success": true}`},
+        "snapshot": {"name": "before"},
+    }
+    for name, runner := range runners {
+        server, err := NewServer(runner, ServerConfig{
+            Timeouts:   defaultDaggerTimeouts(),
+            Simulate:   name == "simulated",
+            DataDir:    t.TempDir(),
+            QueueSize:  1,
+            TestSuites: "test-suites.json",
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, command := range server.commands.All() {
+            t.Run(name+"/"+command.Name, func(t *testing.T) {
+                _, run, err := server.prepareCommand(command.Name, args[command.Name])
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if result := run(context.Background()); result["status"] != InvocationOK {
+                    t.Errorf("%v: %v", result["status"], result["output"])
+                }
+            })
+        }
+    }
+}
+
+func TestJobManagerAcquire(t *testing.T) {
+    jobs := NewJobManager(NewEventBus(64, 100), 100, 1, 2)
+    
+    release, err := jobs.Acquire(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if running, _ := jobs.Stats(); running != 1 {
+        t.Errorf("%d running while a worker is acquired", running)
+    }
+    if views := jobs.List("", ""); len(views) != 0 {
+        t.Errorf("an acquired worker is listed as %+v", views)
+    }
+    
+    // A job queues behind the acquired worker, and an Acquire that gives up
+    // leaves the queue
+    started := make(chan string, 1)
+    done := make(chan struct{})
+    job, _ := jobs.Start(context.Background(), JobSpec{Name: "queued"}, blockingJob("queued", started, done))
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := jobs.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("Acquire with every worker busy: %v", err)
+    }
+    if _, queued := jobs.Stats(); queued[PriorityInteractive] != 1 {
+        t.Errorf("queue after giving up: %v", queued)
+    }
+    
+    release()
+    release()
+    if name := <-started; name != "queued" {
+        t.Errorf("started %s", name)
+    }
+    close(done)
+    waitDone(t, job)
+    if running, _ := jobs.Stats(); running != 0 {
+        t.Errorf("%d running after release", running)
+    }
+}
+
+func TestCORS(t *testing.T) {
+    server, _ := newTestServer(t)
+    server.origins = []string{"https://ops.example"}
+    
+    tests := []struct {
+        name    string
+        method  string
+        origin  string
+        status  int
+        allow   string
+        methods string
+    }{
+        {"no origin", "POST", "", http.StatusOK, "", "GET, POST, PUT, DELETE, OPTIONS"},
+        {"dashboard origin", "POST", "http://example.com", http.StatusOK, "http://example.com", "GET, POST, PUT, DELETE, OPTIONS"},
+        {"configured origin", "POST", "https://ops.example", http.StatusOK, "https://ops.example", "GET, POST, PUT, DELETE, OPTIONS"},
+        {"foreign read", "GET", "https://evil.example", http.StatusOK, "*", "GET, OPTIONS"},
+        {"foreign preflight", "OPTIONS", "https://evil.example", http.StatusOK, "*", "GET, OPTIONS"},
+        {"foreign write", "DELETE", "https://evil.example", http.StatusForbidden, "*", "GET, OPTIONS"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            handler := server.cors(func(w http.ResponseWriter, r *http.Request) {})
+            req := httptest.NewRequest(tt.method, "http://example.com/api/execute", nil)
+            if tt.origin != "" {
+                req.Header.Set("Origin", tt.origin)
+            }
+            rec := httptest.NewRecorder()
+            handler(rec, req)
+            
+            if rec.Code != tt.status {
+                t.Errorf("status %d, want %d", rec.Code, tt.status)
+            }
+            if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+                t.Errorf("Allow-Origin %q, want %q", got, tt.allow)
+            }
+            if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.methods {
+                t.Errorf("Allow-Methods %q, want %q", got, tt.methods)
+            }
+        })
+    }
+}
+
+func TestAgentStore(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "agents.jsonl")
+    store, err := OpenAgentStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    // A reserved name cannot be reserved again until it is released
+    release, err := store.Reserve("coder")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := store.Reserve("coder"); !errors.Is(err, ErrAgentExists) {
+        t.Errorf("second Reserve: %v", err)
+    }
+    if err := store.Add(Agent{ID: "agent-7", Name: "coder", Type: "code"}); err != nil {
+        t.Fatal(err)
+    }
+    release()
+    
+    // Once added, neither the name nor the ID can be taken again
+    for _, name := range []string{"coder", "agent-7"} {
+        if _, err := store.Reserve(name); !errors.Is(err, ErrAgentExists) {
+            t.Errorf("Reserve(%s) after Add: %v", name, err)
+        }
+    }
+    if err := store.Add(Agent{ID: "agent-7", Name: "other"}); !errors.Is(err, ErrAgentExists) {
+        t.Errorf("Add with a taken ID: %v", err)
+    }
+    if err := store.Add(Agent{ID: "tester", Name: "tester", Type: "test"}); err != nil {
+        t.Fatal(err)
+    }
+    
+    before, _ := store.Get("agent-7")
+    after, err := store.Remember("agent-7", "style", "terse")
+    if err != nil || after.Memory["style"] != "terse" || after.UpdatedAt == "" {
+        t.Errorf("Remember = %+v, %v", after, err)
+    }
+    if len(before.Memory) != 0 {
+        t.Errorf("Remember changed an agent handed out earlier: %v", before.Memory)
+    }
+    if _, err := store.Remember("agent-nope", "k", "v"); !errors.Is(err, ErrUnknownAgent) {
+        t.Errorf("Remember on an unknown agent: %v", err)
+    }
+    
+    if deleted, err := store.Delete("tester"); err != nil || deleted.Name != "tester" {
+        t.Errorf("Delete = %+v, %v", deleted, err)
+    }
+    if _, err := store.Delete("tester"); !errors.Is(err, ErrUnknownAgent) {
+        t.Errorf("second Delete: %v", err)
+    }
+    
+    // The registry survives a restart
+    reopened, err := OpenAgentStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    agents := reopened.List("")
+    if len(agents) != 1 || agents[0].ID != "agent-7" || agents[0].Memory["style"] != "terse" {
+        t.Errorf("reopened registry = %+v", agents)
+    }
+    if code := reopened.List("code"); len(code) != 1 {
+        t.Errorf("List(code) = %+v", code)
+    }
+    if test := reopened.List("test"); len(test) != 0 {
+        t.Errorf("List(test) = %+v", test)
+    }
+}
+
+func TestPublishInvocation(t *testing.T) {
+    server, runner := newTestServer(t)
+    sub := server.events.Subscribe(EventFilter{})
+    defer server.events.Unsubscribe(sub)
+    
+    // Both flag spellings name the agents
+    if _, err := server.call(context.Background(), "send-a-2-amessage", "--from-agent=agent-1", "--to-agent", "agent-2"); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case evt := <-sub.C:
+        if agents, _ := evt.Fields["agents"].([]string); evt.Type != EventA2AMessage || !slices.Equal(agents, []string{"agent-1", "agent-2"}) {
+            t.Errorf("published %s %v", evt.Type, evt.Fields)
+        }
+    default:
+        t.Fatal("no event for an A2A message")
+    }
+    
+    // Failed calls announce nothing
+    runner.responses["create-code-agent"] = FakeResponse{Error: "exit status 1"}
+    server.call(context.Background(), "create-code-agent", "--name", "coder")
+    if got := drain(sub); len(got) != 0 {
+        t.Errorf("failed call published %v", got)
+    }
+}
+
+func TestEventFilter(t *testing.T) {
+    a2a := NewEvent(EventA2AMessage, map[string]interface{}{"agents": []string{"agent-1", "agent-2"}})
+    restored := NewEvent(EventA2AMessage, map[string]interface{}{"agents": []interface{}{"agent-1", "agent-2"}})
+    created := NewEvent(EventAgentCreated, map[string]interface{}{"agent": "coder"})
+    status := NewEvent(EventStatusUpdate, map[string]interface{}{"connected": true})
+    truncated := NewEvent(EventReplayTruncated, nil)
+    
+    tests := []struct {
+        query string
+        match []Event
+        skip  []Event
+        err   string
+    }{
+        {query: "", match: []Event{a2a, created, status, truncated}},
+        {query: "topics=a2a,status", match: []Event{a2a, status, truncated}, skip: []Event{created}},
+        {query: "agent=agent-2", match: []Event{a2a, restored, status, truncated}, skip: []Event{created}},
+        {query: "agent=coder&topics=agents", match: []Event{created}, skip: []Event{a2a, status}},
+        {query: "topics=a2a,nope", err: `unknown topic "nope"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            query, _ := url.ParseQuery(tt.query)
+            filter, err := ParseEventFilter(query)
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Errorf("err = %v, want %q", err, tt.err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            for _, evt := range tt.match {
+                if !filter.Match(evt) {
+                    t.Errorf("skipped %s %v", evt.Type, evt.Fields)
+                }
+            }
+            for _, evt := range tt.skip {
+                if filter.Match(evt) {
+                    t.Errorf("matched %s %v", evt.Type, evt.Fields)
+                }
+            }
+        })
+    }
+}